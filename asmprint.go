@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+)
+
+// asmPrinter renders runs of assembly lines with highlighting, an optional
+// line-number gutter that counts across calls, and optional marking of the
+// lines generated from one source line
+type asmPrinter struct {
+	w         io.Writer
+	style     *chroma.Style
+	formatter string
+	lineNo    bool
+	width     int // gutter width, from the total number of lines to print
+	n         int // lines printed so far
+	mark      int // main-file source line whose assembly is marked (0 = none)
+
+	// Column widths for binary mode addresses and opcodes (0 = no such column)
+	addrWidth   int
+	opcodeWidth int
+}
+
+// newAsmPrinter prepares a printer for asm, which may be printed in several calls
+func newAsmPrinter(w io.Writer, opts Options, asm []AsmLine) *asmPrinter {
+	p := &asmPrinter{
+		w:         w,
+		style:     opts.Style,
+		formatter: opts.Formatter,
+		lineNo:    opts.AsmLineNo,
+		width:     len(fmt.Sprint(len(asm))),
+		mark:      opts.HighlightLine,
+	}
+	if opts.Filters.Binary {
+		for _, line := range asm {
+			if len(line.Opcodes) == 0 {
+				continue
+			}
+			p.addrWidth = max(p.addrWidth, len(fmt.Sprintf("%x", line.Address)))
+			p.opcodeWidth = max(p.opcodeWidth, len(strings.Join(line.Opcodes, " ")))
+		}
+	}
+	return p
+}
+
+// encoding is the address and opcode columns of a line, blank for lines
+// without opcodes (labels)
+func (p *asmPrinter) encoding(line AsmLine) string {
+	if len(line.Opcodes) == 0 {
+		return strings.Repeat(" ", p.addrWidth+2+p.opcodeWidth+2)
+	}
+	return colorize("2", fmt.Sprintf("%*x: ", p.addrWidth, line.Address)) +
+		colorize("35", fmt.Sprintf("%-*s  ", p.opcodeWidth, strings.Join(line.Opcodes, " ")))
+}
+
+// fromLine reports whether an assembly line was generated from line n of the main file
+func fromLine(line AsmLine, n int) bool {
+	return line.Source != nil && line.Source.File == nil && line.Source.Line == n
+}
+
+// mapsToLine reports whether any assembly was generated from line n of the main file
+func mapsToLine(asm []AsmLine, n int) bool {
+	for _, line := range asm {
+		if fromLine(line, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// print highlights lines and prints them, adding the gutter and marks after
+// highlighting so they are never colored as assembly
+func (p *asmPrinter) print(lines []AsmLine) {
+	if len(lines) == 0 {
+		return
+	}
+	text := highlight(plainAsm(lines), "gas", p.style, p.formatter)
+	binary := p.opcodeWidth > 0
+	if !p.lineNo && p.mark == 0 && !binary {
+		p.n += len(lines)
+		fmt.Fprint(p.w, text)
+		return
+	}
+	rendered := strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+	for i, line := range rendered {
+		p.n++
+		prefix := ""
+		if p.lineNo {
+			prefix = colorize("2", fmt.Sprintf("%*d ", p.width, p.n))
+		}
+		if p.mark != 0 {
+			if i < len(lines) && fromLine(lines[i], p.mark) {
+				prefix += colorize("33", "▌ ")
+				// Keep the rendered line's ending: the last has none, the final Fprintln ends the block
+				end := ""
+				if strings.HasSuffix(line, "\n") {
+					end = "\n"
+				}
+				line = colorize("1", lines[i].Text) + end
+			} else {
+				prefix += "  "
+			}
+		}
+		if binary && i < len(lines) {
+			prefix += p.encoding(lines[i])
+		}
+		fmt.Fprint(p.w, prefix+line)
+	}
+	fmt.Fprintln(p.w)
+}
+
+// asmBlock is a function label and the lines up to the next function label.
+// Lines before the first label form a block with an empty name.
+type asmBlock struct {
+	name  string
+	lines []AsmLine // including the label line
+}
+
+func splitFunctions(asm []AsmLine) []asmBlock {
+	var blocks []asmBlock
+	for _, line := range asm {
+		if label, ok := funcLabel(line.Text); ok || len(blocks) == 0 {
+			blocks = append(blocks, asmBlock{name: label})
+		}
+		blocks[len(blocks)-1].lines = append(blocks[len(blocks)-1].lines, line)
+	}
+	return blocks
+}
+
+// printFolded prints each function as its label and an instruction count,
+// expanding only the functions matching -func (if given)
+func printFolded(asm []AsmLine, opts Options, p *asmPrinter) {
+	expanded := 0
+	for _, block := range splitFunctions(asm) {
+		if opts.Func != "" && block.name != "" && matchesFunc(block.name, opts.Func, opts.FuncFoldCase) {
+			p.print(block.lines)
+			expanded++
+			continue
+		}
+
+		body := block.lines
+		if block.name != "" {
+			p.print(body[:1])
+			body = body[1:]
+		}
+		count := 0
+		for _, line := range body {
+			if isInstruction(line.Text) {
+				count++
+			}
+		}
+		if count > 0 {
+			fmt.Fprintln(p.w, colorize("2", fmt.Sprintf("        … %d instructions …", count)))
+		}
+	}
+	if opts.Func != "" && expanded == 0 {
+		fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("No function label matching %q found in the assembly", opts.Func)))
+	}
+}
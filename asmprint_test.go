@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAsmPrinterMark(t *testing.T) {
+	line := func(text string, n int) AsmLine {
+		if n == 0 {
+			return AsmLine{Text: text}
+		}
+		return AsmLine{Text: text, Source: &AsmSource{Line: n}}
+	}
+	tests := []struct {
+		name string
+		asm  []AsmLine
+	}{
+		{"marked line in the middle", []AsmLine{line("f:", 0), line("  imul edi, edi", 2), line("  ret", 3)}},
+		{"marked line last", []AsmLine{line("f:", 0), line("  mov eax, edi", 1), line("  imul eax, eax", 2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			p := newAsmPrinter(&out, Options{HighlightLine: 2}, tt.asm)
+			p.print(tt.asm)
+			got := strings.Split(out.String(), "\n")
+			if len(got) != len(tt.asm)+1 || got[len(got)-1] != "" {
+				t.Fatalf("printed %q, want %d lines each ending in a newline", out.String(), len(tt.asm))
+			}
+			for i, l := range tt.asm {
+				marked := strings.HasPrefix(got[i], "▌ ")
+				if marked != fromLine(l, 2) || !strings.HasSuffix(got[i], l.Text) {
+					t.Errorf("line %d = %q, want %q marked %v", i+1, got[i], l.Text, fromLine(l, 2))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// baselineSuffix names a file's default baseline, saved next to it
+const baselineSuffix = ".baseline.s"
+
+// baselinePath is where the -save-baseline and -since baseline for filePath lives
+func baselinePath(opts Options, filePath string) string {
+	if opts.Baseline != "" {
+		return opts.Baseline
+	}
+	return filePath + baselineSuffix
+}
+
+// saveBaseline writes the plain assembly as filePath's baseline
+func saveBaseline(opts Options, filePath string, asm []AsmLine) error {
+	path := baselinePath(opts, filePath)
+	if err := os.WriteFile(path, []byte(plainAsm(asm)), 0o644); err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	if !opts.Quiet && !machineOutput(opts) {
+		fmt.Fprintln(opts.Stderr, colorize("2", fmt.Sprintf("Saved %d lines of assembly as the baseline in %s", len(asm), path)))
+	}
+	return nil
+}
+
+// compileSince compiles the file and prints the diff of its assembly against
+// the saved baseline. It returns the compiler's exit code when the compile
+// fails, else 1 when the assembly changed, so CI can fail on codegen changes.
+func compileSince(ctx context.Context, w io.Writer, opts Options, filePath string) (int, error) {
+	path := baselinePath(opts, filePath)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("no baseline at %s (save one with -save-baseline)", path)
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read baseline: %w", err)
+	}
+
+	p := prepare(opts, filePath)
+	if p.err != nil {
+		return 0, p.err
+	}
+	result, _, err := fetch(ctx, opts, filePath, p.req)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range result.Stderr {
+		fmt.Fprintln(w, colorize("31", line.Text))
+	}
+	if result.Code != 0 {
+		fmt.Fprintln(w, colorize("31", fmt.Sprintf("✗ Compilation failed (exit code %d)", result.Code)))
+		return result.Code, nil
+	}
+
+	fmt.Fprintln(w, "\n"+colorize("36", "━━━ Assembly Diff ━━━"))
+	if printDiff(w, diffLines(baselineTexts(string(data)), asmTexts(result.Asm)), path, "current") {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// baselineTexts splits a saved baseline into lines comparable with asmTexts
+func baselineTexts(data string) []string {
+	if data == "" {
+		return nil
+	}
+	texts := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	for i, text := range texts {
+		texts[i] = strings.TrimRight(text, " \t\r")
+	}
+	return texts
+}
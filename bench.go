@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// benchmark compiles the file count times, bypassing the response cache, then
+// prints the last result as compile would followed by the spread of round
+// trip times and whether the output ever differed between runs
+func benchmark(ctx context.Context, w io.Writer, opts Options, filePath string, count int) (*compileResult, error) {
+	p := prepare(opts, filePath)
+	if p.err != nil {
+		return nil, p.err
+	}
+	if opts.DryRun {
+		return compileRequest(ctx, w, opts, filePath, p.source, p.req)
+	}
+	opts.NoCache = true
+
+	progress := isTerminal(os.Stderr)
+	var times []time.Duration
+	outputs := make(map[string]bool)
+	for i := 1; i < count; i++ {
+		start := time.Now()
+		result, _, err := fetch(ctx, opts, filePath, p.req)
+		if err != nil {
+			return nil, fmt.Errorf("run %d of %d: %w", i, count, err)
+		}
+		times = append(times, time.Since(start))
+		outputs[outputDigest(result)] = true
+		if progress {
+			fmt.Fprint(opts.Stderr, colorize("2", fmt.Sprintf("\rRun %d/%d...", i, count)))
+		}
+	}
+	if progress && count > 1 {
+		fmt.Fprint(opts.Stderr, "\r\033[K")
+	}
+
+	res, err := compileRequest(ctx, w, opts, filePath, p.source, p.req)
+	if err != nil {
+		return nil, err
+	}
+	times = append(times, res.roundTrip)
+	outputs[outputDigest(res.CompileResponse)] = true
+
+	printBenchmark(w, times, len(outputs))
+	return res, nil
+}
+
+// outputDigest is everything a run printed, for telling whether runs agreed
+func outputDigest(r *CompileResponse) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d\n%s", r.Code, plainAsm(r.Asm))
+	for _, lines := range [][]OutputLine{r.Stdout, r.Stderr} {
+		for _, line := range lines {
+			b.WriteString(line.Text + "\n")
+		}
+	}
+	if run := r.ExecResult; run != nil {
+		fmt.Fprintf(&b, "%d\n", run.Code)
+		for _, line := range run.StdOut {
+			b.WriteString(line.Text + "\n")
+		}
+	}
+	return b.String()
+}
+
+// printBenchmark prints min, mean, max and 95th percentile of the round trips
+func printBenchmark(w io.Writer, times []time.Duration, distinct int) {
+	sorted := slices.Clone(times)
+	slices.Sort(sorted)
+	var total time.Duration
+	for _, t := range sorted {
+		total += t
+	}
+	mean := total / time.Duration(len(sorted))
+	// Nearest-rank percentile: the smallest time at least 95% of runs don't exceed
+	p95 := sorted[(len(sorted)*95+99)/100-1]
+
+	round := func(d time.Duration) time.Duration { return d.Round(100 * time.Microsecond) }
+	fmt.Fprintln(w, "\n"+colorize("36", fmt.Sprintf("━━━ Round Trips (%d runs) ━━━", len(times))))
+	fmt.Fprintf(w, "min %s · mean %s · max %s · p95 %s\n", round(sorted[0]), round(mean), round(sorted[len(sorted)-1]), round(p95))
+	if distinct == 1 {
+		fmt.Fprintln(w, colorize("2", "output identical across runs"))
+	} else {
+		fmt.Fprintln(w, colorize("33", fmt.Sprintf("output changed between runs (%d distinct results)", distinct)))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The response cache stores raw Compiler Explorer responses under
+// $XDG_CACHE_HOME/cet/<sha256>.json, keyed by the endpoint and request body.
+// $XDG_CACHE_HOME/cet/latest/ maps each source file to its newest response for -offline.
+
+func cacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "cet"), nil
+}
+
+// cacheKey hashes the endpoint together with the request body, since the
+// compiler ID is part of the URL rather than the JSON
+func cacheKey(url string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(url))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheGet returns the stored response for hash if it exists and is younger than ttl (0 = no expiry)
+func cacheGet(hash string, ttl time.Duration) ([]byte, bool) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, false
+	}
+	path := filepath.Join(dir, hash+".json")
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if ttl > 0 && time.Since(info.ModTime()) > ttl {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// cachePut stores a response body under hash
+func cachePut(hash string, body []byte) error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, hash+".json"), body, 0o644)
+}
+
+// latestKey names the pointer to the newest response for a source file compiled
+// at url with args, so -offline can find it even after the file changed
+func latestKey(url, source, args string) string {
+	h := sha256.New()
+	for _, part := range []string{url, source, args} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachePutLatest records hash as the newest response for a latestKey
+func cachePutLatest(key, hash string) error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	dir = filepath.Join(dir, "latest")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, key), []byte(hash), 0o644)
+}
+
+// cacheLatest returns the newest response recorded under a latestKey, telling
+// apart a missing entry from one older than ttl (0 = no expiry)
+func cacheLatest(key, source string, ttl time.Duration) ([]byte, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	noCache := fmt.Errorf("no cached response for %s with this compiler and arguments (compile it once while online)", source)
+
+	hash, err := os.ReadFile(filepath.Join(dir, "latest", key))
+	if err != nil {
+		return nil, noCache
+	}
+	path := filepath.Join(dir, string(hash)+".json")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, noCache
+	}
+	if age := time.Since(info.ModTime()); ttl > 0 && age > ttl {
+		return nil, fmt.Errorf("the cached response for %s expired %s ago (-cache-ttl=%s; use -cache-ttl=0 to accept any age)",
+			source, (age - ttl).Round(time.Second), ttl)
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,323 @@
+// Package ce is a client for the Compiler Explorer REST API, as served by
+// godbolt.org or a self-hosted instance
+package ce
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultURL is the public Compiler Explorer instance
+const DefaultURL = "https://godbolt.org"
+
+// DefaultGzipThreshold is the request body size from which NewClient's
+// clients compress POST bodies
+const DefaultGzipThreshold = 32 << 10
+
+// Client sends requests to one Compiler Explorer server. The zero value of
+// every field but BaseURL is usable.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client // http.DefaultClient when nil
+	Header  http.Header  // sent with every request, e.g. an Authorization token
+
+	// Retries is how often compile requests are retried after a network error
+	// or 5xx response, with exponential backoff starting at half a second
+	Retries int
+
+	// POST bodies of at least GzipThreshold bytes are sent gzipped with
+	// Content-Encoding: gzip (0 = never)
+	GzipThreshold int
+
+	// Optional hooks, for logging
+	OnRequest  func(req *http.Request, body []byte)
+	OnResponse func(resp *http.Response, body []byte)
+	OnRetry    func(err error, backoff time.Duration, attempt int)
+}
+
+// NewClient returns a client for the server at baseURL (DefaultURL if empty)
+func NewClient(baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), GzipThreshold: DefaultGzipThreshold}
+}
+
+// CompilePath is the endpoint compile requests for compilerID are posted to.
+// CMake projects (a CMakeLists.txt source) use a separate endpoint.
+func CompilePath(compilerID string, cmake bool) string {
+	endpoint := "compile"
+	if cmake {
+		endpoint = "cmake"
+	}
+	return fmt.Sprintf("/api/compiler/%s/%s", compilerID, endpoint)
+}
+
+// Compile compiles req with compilerID
+func (c *Client) Compile(ctx context.Context, compilerID string, req CompileRequest) (*CompileResponse, error) {
+	return c.compile(ctx, CompilePath(compilerID, false), req)
+}
+
+// CMake builds the CMake project in req (CMakeLists.txt as the source, the rest as files) with compilerID
+func (c *Client) CMake(ctx context.Context, compilerID string, req CompileRequest) (*CompileResponse, error) {
+	return c.compile(ctx, CompilePath(compilerID, true), req)
+}
+
+func (c *Client) compile(ctx context.Context, path string, req CompileRequest) (*CompileResponse, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body, err := c.PostJSON(ctx, path, jsonData)
+	if err != nil {
+		return nil, err
+	}
+	return ParseResponse(body)
+}
+
+// ParseResponse decodes the body of a compile response
+func ParseResponse(body []byte) (*CompileResponse, error) {
+	var result CompileResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w\nBody: %s", err, string(body[:min(500, len(body))]))
+	}
+	return &result, nil
+}
+
+// PostJSON posts a JSON body to path and returns the raw response body.
+// Network errors and 5xx responses are retried with exponential backoff;
+// error statuses that remain are returned as a *StatusError, and a body
+// that is not JSON (a login page, say) as a *NotJSONError.
+func (c *Client) PostJSON(ctx context.Context, path string, jsonData []byte) ([]byte, error) {
+	backoff := 500 * time.Millisecond
+
+	for attempt := 0; ; attempt++ {
+		body, resp, err := c.post(ctx, path, jsonData)
+		if err == nil && resp.StatusCode < 400 {
+			if err := checkJSON(resp, body); err != nil {
+				return nil, err
+			}
+			return body, nil
+		}
+		if err == nil {
+			err = newStatusError(resp, body)
+			if resp.StatusCode < 500 {
+				return nil, err
+			}
+		}
+		if attempt >= c.Retries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		if c.OnRetry != nil {
+			c.OnRetry(err, backoff, attempt+1)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Post performs a single POST of a JSON body to path, returning the body and HTTP status
+func (c *Client) Post(ctx context.Context, path string, jsonData []byte) ([]byte, int, error) {
+	body, resp, err := c.post(ctx, path, jsonData)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, resp.StatusCode, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, jsonData []byte) ([]byte, *http.Response, error) {
+	body := jsonData
+	compressed := c.GzipThreshold > 0 && len(jsonData) >= c.GzipThreshold
+	if compressed {
+		var err error
+		if body, err = gzipBody(jsonData); err != nil {
+			return nil, nil, fmt.Errorf("failed to compress request: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return c.do(req, jsonData)
+}
+
+func gzipBody(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GetJSON performs a GET of path and decodes the JSON body into out
+func (c *Client) GetJSON(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	body, resp, err := c.do(req, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return newStatusError(resp, body)
+	}
+	if err := checkJSON(resp, body); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w\nBody: %s", err, string(body[:min(500, len(body))]))
+	}
+	return nil
+}
+
+// do sends req with the client's headers and reads the whole response; the
+// returned response's body is already closed
+func (c *Client) do(req *http.Request, reqBody []byte) ([]byte, *http.Response, error) {
+	req.Header.Set("Accept", "application/json")
+	for name, values := range c.Header {
+		req.Header.Del(name)
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if c.OnRequest != nil {
+		c.OnRequest(req, reqBody)
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The transport only decompresses responses to requests it added
+	// Accept-Encoding to itself, not when a custom header asked for gzip
+	var reader io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress response: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if c.OnResponse != nil {
+		c.OnResponse(resp, body)
+	}
+	return body, resp, nil
+}
+
+// StatusError is a response with an HTTP error status
+type StatusError struct {
+	StatusCode int
+	Body       string        // the start of the body, on one line
+	RetryAfter time.Duration // from the Retry-After header (0 if absent)
+}
+
+func (e *StatusError) Error() string {
+	if e.StatusCode == http.StatusTooManyRequests {
+		if e.RetryAfter > 0 {
+			return fmt.Sprintf("rate limited by the server, retry after %d seconds", int(e.RetryAfter.Round(time.Second).Seconds()))
+		}
+		return "rate limited by the server, retry later"
+	}
+	msg := fmt.Sprintf("server returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// RateLimited reports whether the server refused the request for exceeding its rate limit
+func (e *StatusError) RateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+func newStatusError(resp *http.Response, body []byte) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       bodySnippet(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// NotJSONError is a successful response whose body is not JSON, as from a
+// proxy's login page or a URL that isn't a Compiler Explorer server
+type NotJSONError struct {
+	ContentType string
+	Body        string // the start of the body, on one line
+}
+
+func (e *NotJSONError) Error() string {
+	got := "a non-JSON response"
+	if e.ContentType != "" {
+		got = e.ContentType
+	}
+	return fmt.Sprintf("server did not return JSON (got %s); check the server URL and authentication", got)
+}
+
+// checkJSON rejects a body that is HTML or otherwise labeled as something
+// other than JSON, unless it parses as JSON anyway
+func checkJSON(resp *http.Response, body []byte) error {
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	labeled := mediaType == "" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	html := bytes.HasPrefix(bytes.TrimSpace(body), []byte("<"))
+	if (labeled && !html) || json.Valid(body) {
+		return nil
+	}
+	return &NotJSONError{ContentType: mediaType, Body: bodySnippet(body)}
+}
+
+// bodySnippet is the start of a response body, with whitespace collapsed onto one line
+func bodySnippet(body []byte) string {
+	text := strings.Join(strings.Fields(string(body)), " ")
+	if r := []rune(text); len(r) > 200 {
+		text = string(r[:200]) + "…"
+	}
+	return text
+}
+
+// parseRetryAfter reads a Retry-After value, either seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if secs, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
@@ -0,0 +1,292 @@
+package ce
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCompileRoundTrip(t *testing.T) {
+	var got CompileRequest
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding the request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":0,"asm":[{"text":"square:"},{"text":"  imul edi, edi","source":{"file":null,"line":1}}],"stderr":[{"text":"warning"}]}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL + "/")
+	req := CompileRequest{
+		Source:  "int square(int x) { return x * x; }",
+		Options: CompileOptions{UserArguments: "-O2", Filters: Filters{Intel: true, Labels: true}},
+		Files:   []FileEntry{{Filename: "util.h", Contents: "int util;"}},
+	}
+	resp, err := c.Compile(context.Background(), "g132", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/api/compiler/g132/compile" {
+		t.Errorf("posted to %s", path)
+	}
+	if got.Source != req.Source || got.Options.UserArguments != "-O2" || !got.Options.Filters.Intel || len(got.Files) != 1 {
+		t.Errorf("server got %+v, want %+v", got, req)
+	}
+	if resp.Code != 0 || len(resp.Asm) != 2 || resp.Asm[1].Text != "  imul edi, edi" {
+		t.Fatalf("response = %+v", resp)
+	}
+	if src := resp.Asm[1].Source; src == nil || src.File != nil || src.Line != 1 {
+		t.Errorf("asm source = %+v, want line 1 of the main file", src)
+	}
+	if len(resp.Stderr) != 1 || resp.Stderr[0].Text != "warning" {
+		t.Errorf("stderr = %+v", resp.Stderr)
+	}
+}
+
+func TestCMakePath(t *testing.T) {
+	if got := CompilePath("g132", true); got != "/api/compiler/g132/cmake" {
+		t.Errorf("CompilePath(g132, cmake) = %s", got)
+	}
+}
+
+// flakyServer answers the first failures requests with status, then succeeds
+func flakyServer(t *testing.T, failures int, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= failures {
+			http.Error(w, "try again", status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":0}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestPostJSONRetries5xx(t *testing.T) {
+	server, calls := flakyServer(t, 1, http.StatusBadGateway)
+	c := NewClient(server.URL)
+	c.Retries = 2
+	var retries []time.Duration
+	c.OnRetry = func(err error, backoff time.Duration, attempt int) {
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+			t.Errorf("retry %d after %v, want a 502 StatusError", attempt, err)
+		}
+		retries = append(retries, backoff)
+	}
+
+	body, err := c.PostJSON(context.Background(), "/api/compiler/g132/compile", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"code":0}` {
+		t.Errorf("body = %s", body)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("server saw %d requests, want 2", n)
+	}
+	if len(retries) != 1 || retries[0] != 500*time.Millisecond {
+		t.Errorf("retried with backoffs %v, want [500ms]", retries)
+	}
+}
+
+func TestPostJSONGivesUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		retries int
+		want    int32 // requests the server sees
+	}{
+		{"5xx without retries", http.StatusServiceUnavailable, 0, 1},
+		{"4xx is not retried", http.StatusBadRequest, 3, 1},
+		{"429 is not retried", http.StatusTooManyRequests, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := flakyServer(t, 100, tt.status)
+			c := NewClient(server.URL)
+			c.Retries = tt.retries
+			_, err := c.PostJSON(context.Background(), "/api/compiler/g132/compile", []byte(`{}`))
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+				t.Fatalf("got %v, want a %d StatusError", err, tt.status)
+			}
+			if statusErr.Body != "try again" {
+				t.Errorf("error body = %q", statusErr.Body)
+			}
+			if n := calls.Load(); n != tt.want {
+				t.Errorf("server saw %d requests, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostJSONCancelDuringBackoff(t *testing.T) {
+	server, calls := flakyServer(t, 100, http.StatusInternalServerError)
+	c := NewClient(server.URL)
+	c.Retries = 5
+	ctx, cancel := context.WithCancel(context.Background())
+	c.OnRetry = func(error, time.Duration, int) { cancel() }
+	if _, err := c.PostJSON(ctx, "/api/compiler/g132/compile", []byte(`{}`)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("server saw %d requests, want 1", n)
+	}
+}
+
+func TestGetJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/languages":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`[{"id":"c++","name":"C++","extensions":[".cpp",".cc"]},{"id":"zig","name":"Zig"}]`))
+		case "/login":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>Sign in</body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	c := NewClient(server.URL)
+
+	var langs []struct {
+		ID         string   `json:"id"`
+		Name       string   `json:"name"`
+		Extensions []string `json:"extensions"`
+	}
+	if err := c.GetJSON(context.Background(), "/api/languages", &langs); err != nil {
+		t.Fatal(err)
+	}
+	if len(langs) != 2 || langs[0].ID != "c++" || len(langs[0].Extensions) != 2 || langs[1].Name != "Zig" {
+		t.Errorf("decoded %+v", langs)
+	}
+
+	var out any
+	var notJSON *NotJSONError
+	if err := c.GetJSON(context.Background(), "/login", &out); !errors.As(err, &notJSON) || notJSON.ContentType != "text/html" {
+		t.Errorf("HTML response: got %v, want a NotJSONError", err)
+	}
+	var statusErr *StatusError
+	if err := c.GetJSON(context.Background(), "/missing", &out); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("missing path: got %v, want a 404 StatusError", err)
+	}
+}
+
+func TestPostJSONGzip(t *testing.T) {
+	var encoding string
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		var body io.Reader = r.Body
+		if encoding == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		received, _ = io.ReadAll(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":0}`))
+	}))
+	defer server.Close()
+
+	small := []byte(`{"source":"int x;"}`)
+	large := []byte(`{"source":"` + strings.Repeat("int x;", DefaultGzipThreshold) + `"}`)
+	tests := []struct {
+		name      string
+		threshold int
+		body      []byte
+		want      string
+	}{
+		{"small body", DefaultGzipThreshold, small, ""},
+		{"large body", DefaultGzipThreshold, large, "gzip"},
+		{"compression off", 0, large, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(server.URL)
+			c.GzipThreshold = tt.threshold
+			var logged []byte
+			c.OnRequest = func(_ *http.Request, body []byte) { logged = body }
+			if _, err := c.PostJSON(context.Background(), "/api/compiler/g132/compile", tt.body); err != nil {
+				t.Fatal(err)
+			}
+			if encoding != tt.want {
+				t.Errorf("Content-Encoding = %q, want %q", encoding, tt.want)
+			}
+			if !bytes.Equal(received, tt.body) {
+				t.Errorf("server decoded %d bytes, want the %d sent", len(received), len(tt.body))
+			}
+			if !bytes.Equal(logged, tt.body) {
+				t.Error("OnRequest did not see the uncompressed body")
+			}
+		})
+	}
+}
+
+func TestGzippedResponse(t *testing.T) {
+	const body = `{"code":0,"asm":[{"text":"main:"},{"text":"  ret"}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte(body))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(body))
+		zw.Close()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		// The transport asks for gzip itself and decompresses transparently
+		{"transport", nil},
+		// A custom Accept-Encoding leaves the compressed body to the client
+		{"custom header", http.Header{"Accept-Encoding": {"gzip"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(server.URL)
+			c.Header = tt.header
+			var logged []byte
+			c.OnResponse = func(_ *http.Response, body []byte) { logged = body }
+			resp, err := c.Compile(context.Background(), "g132", CompileRequest{Source: "int main() {}"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Asm) != 2 || resp.Asm[1].Text != "  ret" {
+				t.Errorf("response = %+v", resp)
+			}
+			if string(logged) != body {
+				t.Errorf("OnResponse saw %q, want the decompressed body", logged)
+			}
+		})
+	}
+}
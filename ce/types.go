@@ -0,0 +1,244 @@
+package ce
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The Godbolt API accepts: "files": [{"filename": "helper.zig", "contents": "..."}]
+
+type FileEntry struct {
+	Filename string `json:"filename"`
+	Contents string `json:"contents"`
+}
+
+type CompileRequest struct {
+	Source  string         `json:"source"`
+	Options CompileOptions `json:"options"`
+	Files   []FileEntry    `json:"files,omitempty"`
+
+	// Filename is the main source's logical name, from which a server can tell its language
+	Filename string `json:"filename,omitempty"`
+
+	// BypassCache skips the server's own result caches (see BypassCompilation)
+	BypassCache BypassCache `json:"bypassCache,omitempty"`
+}
+
+// BypassCache selects which server-side caches a request skips
+type BypassCache int
+
+const (
+	BypassNone        BypassCache = iota
+	BypassCompilation             // compile (and run) afresh
+	BypassExecution               // reuse the compile, but run the program afresh
+)
+
+type CompileOptions struct {
+	UserArguments     string             `json:"userArguments"`
+	Filters           Filters            `json:"filters"`
+	ExecuteParameters *ExecuteParameters `json:"executeParameters,omitempty"`
+	CompilerOptions   CompilerOptions    `json:"compilerOptions"`
+	Tools             []ToolEntry        `json:"tools,omitempty"`
+	Libraries         []Library          `json:"libraries,omitempty"`
+	Overrides         []Override         `json:"overrides,omitempty"`
+
+	// Extra sets options this package has no field for, keyed by their dotted
+	// path below "options" (e.g. "compilerOptions.skipAsm"), over the fields above
+	Extra map[string]any `json:"-"`
+}
+
+// MarshalJSON encodes the options with Extra merged in, creating objects along
+// each path as needed
+func (o CompileOptions) MarshalJSON() ([]byte, error) {
+	type plain CompileOptions
+	data, err := json.Marshal(plain(o))
+	if err != nil || len(o.Extra) == 0 {
+		return data, err
+	}
+
+	// UseNumber keeps integers such as timeouts exact through the round trip
+	var merged map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&merged); err != nil {
+		return nil, err
+	}
+	for key, value := range o.Extra {
+		obj := merged
+		parts := strings.Split(key, ".")
+		for i, part := range parts[:len(parts)-1] {
+			next, ok := obj[part].(map[string]any)
+			if !ok {
+				if v, exists := obj[part]; exists && v != nil {
+					return nil, fmt.Errorf("option %s: %s is not an object", key, strings.Join(parts[:i+1], "."))
+				}
+				next = make(map[string]any)
+				obj[part] = next
+			}
+			obj = next
+		}
+		obj[parts[len(parts)-1]] = value
+	}
+	return json.Marshal(merged)
+}
+
+// Library is a server-side library (e.g. fmt or Boost) made available to includes
+type Library struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+}
+
+// Override pins a compiler setting that userArguments cannot express, such as
+// the standard library ("stdlib") or target architecture ("arch"), for
+// compilers that support several
+type Override struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ToolEntry asks the server to run a tool (such as llvm-mca) on the compiler output
+type ToolEntry struct {
+	ID   string `json:"id"`
+	Args string `json:"args"`
+}
+
+// CompilerOptions requests extra outputs alongside the assembly
+type CompilerOptions struct {
+	ProduceOptInfo bool       `json:"produceOptInfo,omitempty"`
+	ProduceIr      *IrOptions `json:"produceIr,omitempty"`
+	ProduceAst     bool       `json:"produceAst,omitempty"`
+	ProducePp      *PpOptions `json:"producePp,omitempty"`
+	CmakeArgs      string     `json:"cmakeArgs,omitempty"`
+}
+
+// PpOptions controls the preprocessor output view
+type PpOptions struct {
+	FilterHeaders bool `json:"filter-headers"`
+	ClangFormat   bool `json:"clang-format"`
+}
+
+// IrOptions controls how much noise is stripped from the LLVM IR output
+type IrOptions struct {
+	FilterDebugInfo     bool `json:"filterDebugInfo"`
+	FilterIRMetadata    bool `json:"filterIRMetadata"`
+	FilterAttributes    bool `json:"filterAttributes"`
+	FilterComments      bool `json:"filterComments"`
+	NoDiscardValueNames bool `json:"noDiscardValueNames"`
+	Demangle            bool `json:"demangle"`
+}
+
+// ExecuteParameters is only sent in execute mode
+type ExecuteParameters struct {
+	Args  []string `json:"args"`
+	Stdin string   `json:"stdin"`
+}
+
+type Filters struct {
+	Binary      bool `json:"binary"`
+	CommentOnly bool `json:"commentOnly"`
+	Demangle    bool `json:"demangle"`
+	Directives  bool `json:"directives"`
+	Intel       bool `json:"intel"`
+	Labels      bool `json:"labels"`
+	Trim        bool `json:"trim"`
+	Execute     bool `json:"execute"`
+}
+
+type CompileResponse struct {
+	Code   int          `json:"code"`
+	Stdout []OutputLine `json:"stdout"`
+	Stderr []OutputLine `json:"stderr"`
+	Asm    []AsmLine    `json:"asm"`
+
+	ExecResult *ExecResult  `json:"execResult,omitempty"`
+	OptOutput  []OptRemark  `json:"optOutput,omitempty"`
+	IrOutput   *IrOutput    `json:"irOutput,omitempty"`
+	AstOutput  []OutputLine `json:"astOutput,omitempty"`
+	PpOutput   *PpOutput    `json:"ppOutput,omitempty"`
+	Tools      []ToolResult `json:"tools,omitempty"`
+	BuildSteps []BuildStep  `json:"buildsteps,omitempty"` // -cmake only
+
+	// Server-side timing in milliseconds, when the server reports it
+	ExecTime json.Number `json:"execTime,omitempty"`
+	TimedOut bool        `json:"timedOut,omitempty"`
+}
+
+// ToolResult is the output of one requested tool
+type ToolResult struct {
+	ID     string       `json:"id"`
+	Name   string       `json:"name"`
+	Code   int          `json:"code"`
+	Stdout []OutputLine `json:"stdout"`
+	Stderr []OutputLine `json:"stderr"`
+}
+
+// PpOutput is only present for the preprocessed view
+type PpOutput struct {
+	NumberOfLinesFiltered int    `json:"numberOfLinesFiltered"`
+	Output                string `json:"output"`
+}
+
+// IrOutput is only present when LLVM IR was requested and the compiler supports it
+type IrOutput struct {
+	Asm []AsmLine `json:"asm"`
+}
+
+// ExecResult is only present when the "execute" filter was requested
+type ExecResult struct {
+	Code     int          `json:"code"`
+	StdOut   []OutputLine `json:"stdout"`
+	StdErr   []OutputLine `json:"stderr"`
+	ExecTime json.Number  `json:"execTime"`
+}
+
+// ExitCode is the compiler's exit code if it failed, otherwise the executed program's (0 when not executing)
+func (r *CompileResponse) ExitCode() int {
+	if r.Code != 0 || r.ExecResult == nil {
+		return r.Code
+	}
+	return r.ExecResult.Code
+}
+
+type OutputLine struct {
+	Text string `json:"text"`
+}
+
+type AsmLine struct {
+	Text   string     `json:"text"`
+	Source *AsmSource `json:"source,omitempty"`
+
+	// Set in binary mode for instructions
+	Address uint64   `json:"address,omitempty"`
+	Opcodes []string `json:"opcodes,omitempty"`
+}
+
+type AsmSource struct {
+	File *string `json:"file"`
+	Line int     `json:"line"`
+}
+
+// OptRemark is one optimization remark, returned in optOutput when produceOptInfo is set
+type OptRemark struct {
+	Pass          string       `json:"Pass"`
+	Name          string       `json:"Name"`
+	Function      string       `json:"Function"`
+	OptType       string       `json:"optType"` // "Passed", "Missed" or "Analysis"
+	DisplayString string       `json:"displayString"`
+	DebugLoc      *OptDebugLoc `json:"DebugLoc,omitempty"`
+}
+
+type OptDebugLoc struct {
+	File   string `json:"File"`
+	Line   int    `json:"Line"`
+	Column int    `json:"Column"`
+}
+
+// BuildStep is one stage (cmake configure, build) of a CMake compile
+type BuildStep struct {
+	Step   string       `json:"step"`
+	Code   int          `json:"code"`
+	Stdout []OutputLine `json:"stdout"`
+	Stderr []OutputLine `json:"stderr"`
+}
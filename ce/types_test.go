@@ -0,0 +1,90 @@
+package ce
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompileOptionsExtra(t *testing.T) {
+	opts := CompileOptions{
+		UserArguments:     "-O2",
+		Filters:           Filters{Intel: true, Labels: true},
+		ExecuteParameters: &ExecuteParameters{Args: []string{"a"}, Stdin: "in"},
+		Libraries:         []Library{{ID: "fmt", Version: "trunk"}},
+		Extra: map[string]any{
+			"compilerOptions.skipAsm":        true,
+			"filters.intel":                  false, // an explicit option wins over the typed field
+			"executeParameters.runtimeTools": []any{},
+			"produceGccDump.opened":          true, // objects are created along the path
+			"lang":                           "c++",
+		},
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(path string) any {
+		var v any = got
+		for _, part := range strings.Split(path, ".") {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return nil
+			}
+			v = obj[part]
+		}
+		return v
+	}
+	checks := []struct {
+		path string
+		want any
+	}{
+		{"userArguments", "-O2"},
+		{"compilerOptions.skipAsm", true},
+		{"filters.intel", false},
+		{"filters.labels", true}, // siblings of an extra option are kept
+		{"filters.binary", false},
+		{"executeParameters.stdin", "in"},
+		{"produceGccDump.opened", true},
+		{"lang", "c++"},
+	}
+	for _, c := range checks {
+		if v := at(c.path); v != c.want {
+			t.Errorf("%s = %v, want %v", c.path, v, c.want)
+		}
+	}
+	if args, ok := at("executeParameters.args").([]any); !ok || len(args) != 1 || args[0] != "a" {
+		t.Errorf("executeParameters.args = %v, want [a]", at("executeParameters.args"))
+	}
+	if tools, ok := at("executeParameters.runtimeTools").([]any); !ok || len(tools) != 0 {
+		t.Errorf("executeParameters.runtimeTools = %v, want []", at("executeParameters.runtimeTools"))
+	}
+	if libs, ok := at("libraries").([]any); !ok || len(libs) != 1 {
+		t.Errorf("libraries = %v, want the fmt library", at("libraries"))
+	}
+}
+
+func TestCompileOptionsWithoutExtra(t *testing.T) {
+	opts := CompileOptions{UserArguments: "-O2", Filters: Filters{Intel: true}}
+	type plain CompileOptions
+	want, _ := json.Marshal(plain(opts))
+	got, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("without Extra got %s, want the plain encoding %s", got, want)
+	}
+}
+
+func TestCompileOptionsExtraNotObject(t *testing.T) {
+	opts := CompileOptions{UserArguments: "-O2", Extra: map[string]any{"userArguments.level": 3}}
+	if _, err := json.Marshal(opts); err == nil || !strings.Contains(err.Error(), "userArguments is not an object") {
+		t.Errorf("got %v, want an error about userArguments", err)
+	}
+}
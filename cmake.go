@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cmakeListsName is the build script sent as the request source in -cmake mode
+const cmakeListsName = "CMakeLists.txt"
+
+// cmakeExts are the source and header extensions uploaded for a CMake project
+var cmakeExts = map[string]bool{
+	".c": true, ".cc": true, ".cpp": true, ".cxx": true,
+	".h": true, ".hh": true, ".hpp": true, ".hxx": true, ".inl": true, ".ipp": true,
+	".cu": true, ".cuh": true,
+	".cmake": true, ".in": true,
+}
+
+// isCMakeProjectFile reports whether a file belongs in a CMake upload: sources,
+// headers and the build scripts of subdirectories
+func isCMakeProjectFile(name string) bool {
+	return name == cmakeListsName || cmakeExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// findCMakeRoot returns the nearest directory at or above dir with a CMakeLists.txt
+func findCMakeRoot(dir string) (string, error) {
+	for start := dir; ; {
+		if _, err := os.Stat(filepath.Join(dir, cmakeListsName)); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no %s found in %s or its parents (set -root to the CMake project)", cmakeListsName, start)
+		}
+		dir = parent
+	}
+}
+
+// printFailedSteps prints the output of the CMake steps that failed
+func printFailedSteps(w io.Writer, steps []BuildStep) {
+	for _, step := range steps {
+		if step.Code == 0 {
+			continue
+		}
+		fmt.Fprintln(w, "\n"+colorize("36", fmt.Sprintf("━━━ Build Step: %s ━━━", step.Step)))
+		for _, line := range step.Stdout {
+			fmt.Fprintln(w, line.Text)
+		}
+		for _, line := range step.Stderr {
+			fmt.Fprintln(w, colorize("31", line.Text))
+		}
+		fmt.Fprintln(w, colorize("31", fmt.Sprintf("✗ %s failed (exit code %d)", step.Step, step.Code)))
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cet/ce"
+)
+
+// compilersPath lists the fields of the compiler list cet uses
+const compilersPath = "/api/compilers?fields=id,name,lang"
+
+// fetchCompilers returns the server's compiler list, kept in the response cache
+// for ttl (unless noCache) so the checks before each compile don't cost a round trip
+func fetchCompilers(api *ce.Client, noCache bool, ttl time.Duration) ([]Compiler, error) {
+	if !noCache {
+		if compilers, ok := cachedCompilers(api, ttl); ok {
+			return compilers, nil
+		}
+	}
+	var compilers []Compiler
+	if err := api.GetJSON(context.Background(), compilersPath, &compilers); err != nil {
+		return nil, err
+	}
+	if body, err := json.Marshal(compilers); err == nil && !noCache {
+		cachePut(cacheKey(api.BaseURL+compilersPath, nil), body) // best effort; the list is fetched again next time
+	}
+	return compilers, nil
+}
+
+// cachedCompilers returns the compiler list from the response cache, without a request
+func cachedCompilers(api *ce.Client, ttl time.Duration) ([]Compiler, bool) {
+	var compilers []Compiler
+	body, ok := cacheGet(cacheKey(api.BaseURL+compilersPath, nil), ttl)
+	return compilers, ok && json.Unmarshal(body, &compilers) == nil
+}
+
+// looksLikeCompilerID reports whether query is shaped like a Compiler Explorer
+// ID (g132, clang1910, ztrunk) rather than a name to look up (clang19, "gcc 13"):
+// lowercase, with a version of three or more digits or a trunk or snapshot build
+func looksLikeCompilerID(query string) bool {
+	if query == "" || strings.ContainsFunc(query, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("_.-", r))
+	}) {
+		return false
+	}
+	if strings.Contains(query, "trunk") || strings.Contains(query, "snapshot") {
+		return true
+	}
+	return slices.ContainsFunc(compilerTokens(query), func(tok string) bool {
+		return len(tok) >= 3 && tok[0] >= '0' && tok[0] <= '9'
+	})
+}
+
+// expectedLangs lists the Compiler Explorer languages a file can be compiled as.
+// Headers and CUDA sources are ambiguous, so they accept more than one.
+func expectedLangs(filePath, override string) []string {
+	if override == "" {
+		if filepath.Base(filePath) == cmakeListsName {
+			return []string{"c++", "c"}
+		}
+		switch strings.ToLower(filepath.Ext(filePath)) {
+		case ".h":
+			return []string{"c", "c++"}
+		case ".cu", ".cuh":
+			return []string{"cuda", "c++"}
+		}
+	}
+	return []string{ceLanguage(getLangFromFile(filePath, override))}
+}
+
+// checkCompilerLang reports a mismatch between the file's language and the
+// language of opts.Compiler in the server's compiler list
+func checkCompilerLang(opts Options, compilers []Compiler, filePath string) error {
+	i := slices.IndexFunc(compilers, func(c Compiler) bool { return c.ID == opts.Compiler })
+	if i < 0 {
+		return fmt.Errorf("compiler %s is not available on %s (see -list-compilers)", opts.Compiler, opts.Server)
+	}
+	name := sourceName(opts, filePath)
+	want := expectedLangs(name, opts.Lang)
+	if c := compilers[i]; !slices.Contains(want, c.Lang) {
+		return fmt.Errorf("%s looks like %s, but compiler %s (%s) is for %s", name, strings.Join(want, "/"), c.ID, c.Name, c.Lang)
+	}
+	return nil
+}
+
+// compilerTokens splits an ID, name or query into lowercase runs of letters and
+// digits, so "clang 19", "clang19" and "x86-64 clang 19.1.0" are comparable
+func compilerTokens(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	kind := 0 // 1 letters, 2 digits
+	for _, r := range strings.ToLower(s) {
+		k := 0
+		switch {
+		case r >= 'a' && r <= 'z':
+			k = 1
+		case r >= '0' && r <= '9':
+			k = 2
+		}
+		if k != kind && cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+		kind = k
+		if k != 0 {
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// tokensMatch reports whether every query token is a prefix of some candidate token
+func tokensMatch(query, candidate []string) bool {
+	for _, q := range query {
+		if !slices.ContainsFunc(candidate, func(c string) bool { return strings.HasPrefix(c, q) }) {
+			return false
+		}
+	}
+	return true
+}
+
+type compilerMatch struct {
+	Compiler
+	score int
+}
+
+// matchCompilers ranks the compilers that fuzzily match query: those whose ID
+// starts with the query first, then those for one of langs, then newest-looking IDs
+func matchCompilers(compilers []Compiler, query string, langs []string) []compilerMatch {
+	q := compilerTokens(query)
+	if len(q) == 0 {
+		return nil
+	}
+	flat := strings.Join(q, "")
+
+	var matches []compilerMatch
+	for _, c := range compilers {
+		idTokens := compilerTokens(c.ID)
+		if !tokensMatch(q, idTokens) && !tokensMatch(q, compilerTokens(c.Name)) {
+			continue
+		}
+		score := 0
+		if strings.HasPrefix(strings.Join(idTokens, ""), flat) {
+			score += 100
+		}
+		if slices.Contains(langs, c.Lang) {
+			score += 50
+		}
+		matches = append(matches, compilerMatch{c, score})
+	}
+	slices.SortStableFunc(matches, func(a, b compilerMatch) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+	return matches
+}
+
+// maxCompilerChoices limits how many candidates are offered for an ambiguous -compiler
+const maxCompilerChoices = 10
+
+// resolveCompiler turns a fuzzy -compiler value such as "clang19" or "gcc 13"
+// into a real compiler ID from the server's compiler list. IDs in the list are
+// returned as is. With several candidates the user picks one if interactive;
+// otherwise the best-ranked one is used.
+func resolveCompiler(opts Options, compilers []Compiler, query string, langs []string, interactive bool) (string, error) {
+	if slices.ContainsFunc(compilers, func(c Compiler) bool { return c.ID == query }) {
+		return query, nil
+	}
+
+	matches := matchCompilers(compilers, query, langs)
+	switch {
+	case len(matches) == 0:
+		return "", fmt.Errorf("no compiler matches %q (see -list-compilers)", query)
+	case len(matches) == 1:
+		fmt.Fprintln(opts.Stderr, colorize("2", fmt.Sprintf("Using compiler %s (%s)", matches[0].ID, matches[0].Name)))
+		return matches[0].ID, nil
+	}
+
+	shown := matches[:min(len(matches), maxCompilerChoices)]
+	fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("%q matches several compilers:", query)))
+	for i, m := range shown {
+		fmt.Fprintf(opts.Stderr, "  %2d) %-14s %s\n", i+1, m.ID, m.Name)
+	}
+	if len(matches) > len(shown) {
+		fmt.Fprintf(opts.Stderr, "      … and %d more\n", len(matches)-len(shown))
+	}
+	if !interactive {
+		fmt.Fprintln(opts.Stderr, colorize("2", fmt.Sprintf("Using %s; pass an exact -compiler ID to choose another", shown[0].ID)))
+		return shown[0].ID, nil
+	}
+
+	fmt.Fprintf(opts.Stderr, "Select a compiler [1-%d] (Enter for 1): ", len(shown))
+	var answer string
+	fmt.Scanln(&answer)
+	if answer == "" {
+		return shown[0].ID, nil
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(shown) {
+		return "", fmt.Errorf("invalid choice %q", answer)
+	}
+	return shown[n-1].ID, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// testCompilers is a compiler list as the server returns it
+var testCompilers = []Compiler{
+	{ID: "g132", Name: "x86-64 gcc 13.2", Lang: "c++"},
+	{ID: "cg132", Name: "x86-64 gcc 13.2", Lang: "c"},
+	{ID: "clang1910", Name: "x86-64 clang 19.1.0", Lang: "c++"},
+	{ID: "cclang1910", Name: "x86-64 clang 19.1.0", Lang: "c"},
+	{ID: "z0140", Name: "zig 0.14.0", Lang: "zig"},
+	{ID: "nvcc128", Name: "NVCC 12.8", Lang: "cuda"},
+}
+
+func TestCheckCompilerLang(t *testing.T) {
+	tests := []struct {
+		compiler, file, lang string
+		wantErr              string // substring, "" for no error
+	}{
+		{"g132", "main.cpp", "", ""},
+		{"cg132", "main.c", "", ""},
+		{"g132", "util.h", "", ""}, // headers are C or C++
+		{"cg132", "util.h", "", ""},
+		{"nvcc128", "kernel.cu", "", ""},
+		{"z0140", "main.zig", "", ""},
+		{"g132", "main.c", "c++", ""}, // -lang wins over the extension
+		{"g132", "main.c", "", "main.c looks like c, but compiler g132 (x86-64 gcc 13.2) is for c++"},
+		{"z0140", "main.cpp", "", "is for zig"},
+		{"g999", "main.cpp", "", "compiler g999 is not available"},
+	}
+	for _, tt := range tests {
+		opts := Options{Compiler: tt.compiler, Lang: tt.lang, Server: "https://godbolt.org"}
+		err := checkCompilerLang(opts, testCompilers, tt.file)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s with %s: unexpected error %v", tt.file, tt.compiler, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s with %s: error %v, want one containing %q", tt.file, tt.compiler, err, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveCompiler(t *testing.T) {
+	tests := []struct {
+		query   string
+		langs   []string
+		want    string
+		note    string // expected on stderr, "" for silence
+		wantErr bool
+	}{
+		{query: "g132", langs: []string{"c"}, want: "g132"}, // exact IDs win even for another language
+		{query: "cclang1910", langs: []string{"c++"}, want: "cclang1910"},
+		{query: "zig", want: "z0140", note: "Using compiler z0140"},
+		{query: "clang 19", langs: []string{"c++"}, want: "clang1910", note: "matches several compilers"},
+		{query: "clang19", langs: []string{"c"}, want: "clang1910", note: "matches several compilers"}, // an ID prefix outranks the language
+		{query: "gcc 13", langs: []string{"c"}, want: "cg132", note: "Using cg132"},
+		{query: "msvc", wantErr: true},
+	}
+	for _, tt := range tests {
+		var stderr strings.Builder
+		opts := Options{Stderr: &stderr}
+		got, err := resolveCompiler(opts, testCompilers, tt.query, tt.langs, false)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveCompiler(%q): error %v, want error %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveCompiler(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+		if tt.note == "" && stderr.Len() > 0 {
+			t.Errorf("resolveCompiler(%q) printed %q, want nothing", tt.query, stderr.String())
+		} else if !strings.Contains(stderr.String(), tt.note) {
+			t.Errorf("resolveCompiler(%q) printed %q, want %q", tt.query, stderr.String(), tt.note)
+		}
+	}
+}
+
+func TestLooksLikeCompilerID(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"g132", true},
+		{"clang1910", true},
+		{"z0140", true},
+		{"ztrunk", true},
+		{"clang_trunk", true},
+		{"gsnapshot", true},
+		{"clang19", false},
+		{"gcc 13", false},
+		{"zig", false},
+		{"Clang1910", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := looksLikeCompilerID(tt.query); got != tt.want {
+			t.Errorf("looksLikeCompilerID(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// hiddenFlags are left out of -help and the completion scripts
+var hiddenFlags = map[string]bool{"completion": true}
+
+// printDefaults is flag.PrintDefaults without the hidden flags. The defaults
+// shown are the built-in ones, even once a config file has changed the values.
+func printDefaults(stderr io.Writer) {
+	visible := flag.NewFlagSet("cet", flag.ContinueOnError)
+	visible.SetOutput(stderr)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// listCompilerIDs is the shell pipeline the scripts use to complete compiler IDs,
+// taking the first column of -list-compilers without the language headers
+const listCompilerIDs = `cet -color=never -list-compilers 2>/dev/null | awk 'NF && $1 !~ /^━/ {print $1}'`
+
+// completionValues are the fixed choices of flags with a closed set of values
+func completionValues() map[string][]string {
+	return map[string][]string{
+		"color":  {"auto", "always", "never"},
+		"sample": {"zig", "cpp"},
+		"view":   strings.Split(viewNames(), ", "),
+	}
+}
+
+// compilerFlags take a compiler ID, completed from the server (the bash script lists them too)
+var compilerFlags = map[string]bool{"compiler": true, "diff-compiler": true}
+
+// pathFlags take a file or directory
+var pathFlags = map[string]bool{"root": true, "o": true, "style-file": true, "stdin": true}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// visibleFlags are the flags offered for completion
+func visibleFlags() []*flag.Flag {
+	var flags []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			flags = append(flags, f)
+		}
+	})
+	return flags
+}
+
+// printCompletion writes the completion script for shell (bash, zsh or fish)
+func printCompletion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		printBashCompletion(w)
+	case "zsh":
+		printZshCompletion(w)
+	case "fish":
+		printFishCompletion(w)
+	default:
+		return fmt.Errorf("unsupported shell %q for -completion (use bash, zsh or fish)", shell)
+	}
+	return nil
+}
+
+func printBashCompletion(w io.Writer) {
+	var names []string
+	for _, f := range visibleFlags() {
+		names = append(names, "-"+f.Name)
+	}
+
+	fmt.Fprintln(w, "# bash completion for cet; load with: source <(cet -completion bash)")
+	fmt.Fprintf(w, "_cet_compilers() { %s; }\n\n", listCompilerIDs)
+	fmt.Fprintln(w, "_cet() {")
+	fmt.Fprintln(w, `	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}`)
+	fmt.Fprintln(w, `	# -flag=value arrives as "-flag" "=" "value"`)
+	fmt.Fprintln(w, `	if [[ $cur == = ]]; then cur=; elif [[ $prev == = ]]; then prev=${COMP_WORDS[COMP_CWORD-2]}; fi`)
+	fmt.Fprintln(w, `	case ${prev#-} in`)
+	fmt.Fprintln(w, "\tcompiler|diff-compiler) COMPREPLY=($(compgen -W \"$(_cet_compilers)\" -- \"$cur\")); return ;;")
+	fmt.Fprintln(w, "\ttheme) COMPREPLY=($(compgen -W \"$(cet -list-themes 2>/dev/null)\" -- \"$cur\")); return ;;")
+	values := completionValues()
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", name, strings.Join(values[name], " "))
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if [[ $cur == -* ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _cet cet")
+}
+
+func printZshCompletion(w io.Writer) {
+	// Descriptions sit in [...] and values after ':', so those need escaping
+	escape := strings.NewReplacer("[", `\[`, "]", `\]`, ":", `\:`, "'", `'\''`).Replace
+	values := completionValues()
+
+	fmt.Fprintln(w, "#compdef cet")
+	fmt.Fprintln(w, "# zsh completion for cet; load with: source <(cet -completion zsh)")
+	fmt.Fprintln(w, "_cet_compilers() {")
+	fmt.Fprintf(w, "\tlocal -a ids\n\tids=(${(f)\"$(%s)\"})\n", listCompilerIDs)
+	fmt.Fprintln(w, "\tcompadd -a ids")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "_cet() {")
+	fmt.Fprintln(w, "\t_arguments \\")
+	for _, f := range visibleFlags() {
+		spec := fmt.Sprintf("-%s[%s]", f.Name, escape(f.Usage))
+		if !isBoolFlag(f) {
+			action := ""
+			switch {
+			case compilerFlags[f.Name]:
+				action = "_cet_compilers"
+			case f.Name == "theme":
+				action = `{_values theme $(cet -list-themes 2>/dev/null)}`
+			case values[f.Name] != nil:
+				action = "(" + strings.Join(values[f.Name], " ") + ")"
+			case pathFlags[f.Name]:
+				action = "_files"
+			}
+			spec = fmt.Sprintf("-%s=-[%s]:%s:%s", f.Name, escape(f.Usage), f.Name, action)
+		}
+		fmt.Fprintf(w, "\t\t'%s' \\\n", spec)
+	}
+	fmt.Fprintln(w, "\t\t'*:file:_files'")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, `if [ "$funcstack[1]" = "_cet" ]; then _cet "$@"; else compdef _cet cet; fi`)
+}
+
+func printFishCompletion(w io.Writer) {
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+	}
+	values := completionValues()
+
+	fmt.Fprintln(w, "# fish completion for cet; load with: cet -completion fish | source")
+	for _, f := range visibleFlags() {
+		line := fmt.Sprintf("complete -c cet -o %s -d %s", f.Name, quote(f.Usage))
+		switch {
+		case isBoolFlag(f):
+		case compilerFlags[f.Name]:
+			line += " -x -a " + quote("("+listCompilerIDs+")")
+		case f.Name == "theme":
+			line += " -x -a '(cet -list-themes 2>/dev/null)'"
+		case values[f.Name] != nil:
+			line += " -x -a " + quote(strings.Join(values[f.Name], " "))
+		case pathFlags[f.Name]:
+			line += " -r -F"
+		default:
+			line += " -x"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// exitWithCompletion prints the -completion script and exits
+func exitWithCompletion(stdout, stderr io.Writer, shell string) {
+	if err := printCompletion(stdout, shell); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
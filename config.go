@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Settings are layered lowest to highest: built-in flag defaults, the config
+// file, the nearest .cet.toml above the source file, CET_* environment
+// variables, the -profile section, then the command line. Config keys and
+// environment variables mirror the flag names ("no-clear" is CET_NO_CLEAR).
+// Profiles are [profile.<name>] sections in either config file.
+//
+// Config files use a small subset of TOML: key = value pairs with string,
+// boolean, number and single-line string array values, plus [section] headers.
+
+// configEntry is one key = value line; arrays have several values
+type configEntry struct {
+	key    string
+	values []string
+	line   int
+}
+
+type config struct {
+	path     string
+	sections map[string][]configEntry // "" holds the top-level keys
+	project  bool                     // a .cet.toml, limited to projectSettings
+	stderr   io.Writer                // where ignored project settings are reported
+}
+
+// configPath returns $CET_CONFIG if set, otherwise the per-user config file
+func configPath() (string, bool) {
+	if p := os.Getenv("CET_CONFIG"); p != "" {
+		return p, true
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(base, "cet", "config.toml"), false
+}
+
+// loadConfig parses the config file at path. A missing file is only an error when required.
+func loadConfig(path string, required bool) (*config, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return &config{path: path, sections: map[string][]configEntry{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	defer f.Close()
+
+	cfg := &config{path: path, sections: map[string][]configEntry{}}
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%s:%d: unterminated section header", path, n)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		values, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		cfg.sections[section] = append(cfg.sections[section], configEntry{key: key, values: values, line: n})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return cfg, nil
+}
+
+// stripComment removes a trailing # comment that is not inside a string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigValue converts a TOML value into flag strings
+func parseConfigValue(raw string) ([]string, error) {
+	if strings.HasPrefix(raw, "[") {
+		if !strings.HasSuffix(raw, "]") {
+			return nil, fmt.Errorf("arrays must be on a single line")
+		}
+		var values []string
+		for _, item := range splitArray(raw[1 : len(raw)-1]) {
+			v, err := parseConfigScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	v, err := parseConfigScalar(raw)
+	if err != nil {
+		return nil, err
+	}
+	return []string{v}, nil
+}
+
+// splitArray splits array items on commas outside of strings, dropping a trailing comma
+func splitArray(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+func parseConfigScalar(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", fmt.Errorf("missing value")
+	case strings.HasPrefix(raw, `"`):
+		v, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return v, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case raw == "true" || raw == "false":
+		return raw, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(raw, "_", ""), 64); err == nil {
+		return strings.ReplaceAll(raw, "_", ""), nil
+	}
+	return "", fmt.Errorf("unsupported value %s (quote strings)", raw)
+}
+
+// projectConfigName is the per-project config file, searched for upwards from the source file
+const projectConfigName = ".cet.toml"
+
+// pathSettings are resolved relative to the config file that sets them
+var pathSettings = map[string]bool{"root": true, "o": true}
+
+// projectSettings are the settings a .cet.toml may change. A project config
+// comes with whatever repository was cloned, so it is limited to what is
+// compiled and how it is shown: nothing that runs commands (on-success),
+// redirects the source or credentials (server, proxy, header, token), reads
+// files beyond the project (stdin, file, style-file, or a root above the
+// config's directory) or writes and publishes anything (o, copy, link,
+// save-baseline).
+var projectSettings = map[string]bool{
+	// What to compile, and with what
+	"compiler": true, "args": true, "lang": true, "filename": true, "lines": true,
+	"view": true, "execute": true, "prog-args": true, "lib": true, "override": true, "opt": true,
+	"root": true, "include": true, "exclude": true, "skip": true, "no-multifile": true,
+	"max-size": true, "max-file-size": true, "max-source": true, "cmake": true, "cmake-args": true, "zig-build": true,
+	"strict": true, "compilers": true, "targets": true, "diff-compiler": true, "diff-args": true,
+	// Filters
+	"intel": true, "labels": true, "directives": true, "comments": true, "demangle": true,
+	"trim": true, "binary": true,
+	// Extra outputs and display
+	"source": true, "interleave": true, "split": true, "stats": true, "asm-lineno": true,
+	"fold": true, "tidy": true, "timing": true, "highlight-line": true, "opt-remarks": true,
+	"ir": true, "mca": true, "func": true, "ifunc": true, "grep": true, "A": true, "B": true,
+	"context": true, "theme": true, "quiet": true, "json": true, "template": true,
+	// Watch behavior
+	"debounce": true, "no-clear": true, "watch-diff": true, "keep-errors": true,
+}
+
+// apply sets the flags named by the entries of a section, leaving those in skip
+// untouched. A project config's settings outside projectSettings are ignored
+// with a warning.
+func (c *config) apply(fset *flag.FlagSet, section string, skip map[string]bool) error {
+	startLayer(fset)
+	for _, e := range c.sections[section] {
+		f := fset.Lookup(e.key)
+		if f == nil {
+			return fmt.Errorf("%s:%d: unknown setting %q", c.path, e.line, e.key)
+		}
+		if skip[e.key] {
+			continue
+		}
+		if c.project && !projectSettings[e.key] {
+			fmt.Fprintf(c.stderr, "Warning: %s:%d: ignoring %s, which a project config cannot set (use the user config or the command line)\n", c.path, e.line, e.key)
+			continue
+		}
+		for _, v := range e.values {
+			if pathSettings[e.key] && !filepath.IsAbs(v) {
+				v = filepath.Join(filepath.Dir(c.path), v)
+			}
+			if c.project && e.key == "root" && !withinDir(filepath.Dir(c.path), v) {
+				fmt.Fprintf(c.stderr, "Warning: %s:%d: ignoring root %s, which is outside the project\n", c.path, e.line, v)
+				continue
+			}
+			if err := f.Value.Set(v); err != nil {
+				return fmt.Errorf("%s:%d: invalid value for %s: %w", c.path, e.line, e.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// withinDir reports whether path is dir or below it
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// envName is the environment variable that mirrors a flag
+func envName(flagName string) string {
+	return "CET_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// startLayer makes the next values of every repeatable flag replace those set
+// by the layers below, so that a -lib on the command line is not added to the
+// config file's libraries
+func startLayer(fset *flag.FlagSet) {
+	fset.VisitAll(func(f *flag.Flag) {
+		if m, ok := f.Value.(*multiFlag); ok {
+			m.replace = true
+		}
+	})
+}
+
+// applyEnv sets every flag whose CET_* environment variable is present
+func applyEnv(fset *flag.FlagSet) error {
+	startLayer(fset)
+	var err error
+	fset.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if setErr := f.Value.Set(v); setErr != nil {
+			err = fmt.Errorf("invalid $%s: %w", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// loadDefaults seeds the flags from the config file and environment before the
+// command line is parsed, returning the config for applyProfile (nil if there is none).
+// The -help defaults stay the built-in ones, and repeatable flags given on the
+// command line replace the seeded values.
+func loadDefaults(fset *flag.FlagSet) (*config, error) {
+	path, required := configPath()
+	var cfg *config
+	if path != "" {
+		var err error
+		cfg, err = loadConfig(path, required)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.apply(fset, "", nil); err != nil {
+			return nil, err
+		}
+	}
+	err := applyEnv(fset)
+	startLayer(fset)
+	return cfg, err
+}
+
+// findProjectConfig returns the nearest .cet.toml in dir or one of its parents
+func findProjectConfig(dir string) (string, bool) {
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// applyProjectConfig applies the nearest .cet.toml above dir to every flag not
+// already set on the command line or through the environment. It runs after
+// flag.Parse, since the source file's location is only known then. The returned
+// config is nil when no project config exists. Ignored settings are reported
+// on stderr.
+func applyProjectConfig(fset *flag.FlagSet, stderr io.Writer, dir string) (*config, error) {
+	path, ok := findProjectConfig(dir)
+	if !ok {
+		return nil, nil
+	}
+	cfg, err := loadConfig(path, true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.project = true
+	cfg.stderr = stderr
+
+	explicit := map[string]bool{}
+	fset.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	fset.VisitAll(func(f *flag.Flag) {
+		if _, ok := os.LookupEnv(envName(f.Name)); ok {
+			explicit[f.Name] = true
+		}
+	})
+	return cfg, cfg.apply(fset, "", explicit)
+}
+
+// applyProfile applies the [profile.<name>] section to every flag not set on the
+// command line. The project config's profile wins over one of the same name in
+// the user config.
+func applyProfile(fset *flag.FlagSet, name string, configs ...*config) error {
+	section := "profile." + name
+	explicit := map[string]bool{}
+	fset.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var defined []string
+	for _, cfg := range configs {
+		if cfg == nil {
+			continue
+		}
+		if _, ok := cfg.sections[section]; ok {
+			return cfg.apply(fset, section, explicit)
+		}
+		for s := range cfg.sections {
+			if p, ok := strings.CutPrefix(s, "profile."); ok {
+				defined = append(defined, p)
+			}
+		}
+	}
+	if len(defined) == 0 {
+		return fmt.Errorf("unknown profile %q (no [profile.<name>] sections are configured)", name)
+	}
+	sort.Strings(defined)
+	return fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(defined, ", "))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes contents to path under dir, creating its directories
+func writeFile(t *testing.T, dir, path, contents string) {
+	t.Helper()
+	path = filepath.Join(dir, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyProjectConfigNested(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, ".cet.toml", "compiler = \"outer\"\nlang = \"zig\"\n")
+	writeFile(t, dir, "a/.cet.toml", strings.Join([]string{
+		`compiler = "inner"`,
+		`args = "-O2"`,
+		`lang = "c"`,
+		`root = "src"`,
+		`server = "http://attacker.example"`,
+		`on-success = "rm -rf ~"`,
+	}, "\n")+"\n")
+	if err := os.MkdirAll(filepath.Join(dir, "a/b/c"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CET_LANG", "cpp")
+
+	fset := flag.NewFlagSet("cet", flag.ContinueOnError)
+	compiler := fset.String("compiler", "ztrunk", "")
+	args := fset.String("args", "", "")
+	lang := fset.String("lang", "", "")
+	root := fset.String("root", "", "")
+	server := fset.String("server", "https://godbolt.org", "")
+	onSuccess := fset.String("on-success", "", "")
+	if err := fset.Parse([]string{"-args=-O0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings strings.Builder
+	cfg, err := applyProjectConfig(fset, &warnings, filepath.Join(dir, "a/b/c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "a", projectConfigName); cfg == nil || cfg.path != want {
+		t.Fatalf("applied %v, want the nearest config %s", cfg, want)
+	}
+
+	checks := []struct {
+		name, got, want string
+	}{
+		{"compiler", *compiler, "inner"},                // nearest config wins over the outer one
+		{"args", *args, "-O0"},                          // the command line wins
+		{"lang", *lang, ""},                             // set through CET_LANG, left to applyEnv
+		{"root", *root, filepath.Join(dir, "a", "src")}, // relative to the config file
+		{"server", *server, "https://godbolt.org"},      // not allowed in a project config
+		{"on-success", *onSuccess, ""},                  // not allowed in a project config
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("-%s = %q, want %q", c.name, c.got, c.want)
+		}
+	}
+	for _, key := range []string{"server", "on-success"} {
+		if !strings.Contains(warnings.String(), "ignoring "+key) {
+			t.Errorf("no warning about %s in %q", key, warnings.String())
+		}
+	}
+
+	// A root may not reach above the config's directory, or include could upload any file
+	for _, outside := range []string{"/etc", "../..", "src/../.."} {
+		writeFile(t, dir, "a/b/.cet.toml", fmt.Sprintf("root = %q\n", outside))
+		fset := flag.NewFlagSet("cet", flag.ContinueOnError)
+		root := fset.String("root", "", "")
+		var warnings strings.Builder
+		if _, err := applyProjectConfig(fset, &warnings, filepath.Join(dir, "a/b/c")); err != nil {
+			t.Fatal(err)
+		}
+		if *root != "" || !strings.Contains(warnings.String(), "outside the project") {
+			t.Errorf("root = %q: got -root=%q, warnings %q; want it ignored", outside, *root, warnings.String())
+		}
+	}
+}
+
+func TestApplyProjectConfigMissing(t *testing.T) {
+	fset := flag.NewFlagSet("cet", flag.ContinueOnError)
+	fset.String("compiler", "ztrunk", "")
+	cfg, err := applyProjectConfig(fset, os.Stderr, t.TempDir())
+	if err != nil || cfg != nil {
+		t.Errorf("got %v, %v; want no config", cfg, err)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "config.toml", strings.Join([]string{
+		`compiler = "from-config"`,
+		`args = "-O1"`,
+		`lang = "c"`,
+		`lib = ["fmt:trunk", "range-v3:trunk"]`,
+		`header = ["X-One=1"]`,
+		`override = ["stdlib=libc++"]`,
+	}, "\n")+"\n")
+	t.Setenv("CET_CONFIG", filepath.Join(dir, "config.toml"))
+	t.Setenv("CET_ARGS", "-O2")
+	t.Setenv("CET_LANG", "cpp")
+	t.Setenv("CET_HEADER", "X-Two=2")
+
+	fset := flag.NewFlagSet("cet", flag.ContinueOnError)
+	server := fset.String("server", "https://godbolt.org", "")
+	compiler := fset.String("compiler", "ztrunk", "")
+	args := fset.String("args", "", "")
+	lang := fset.String("lang", "", "")
+	var libs, headers, overrides multiFlag
+	fset.Var(&libs, "lib", "")
+	fset.Var(&headers, "header", "")
+	fset.Var(&overrides, "override", "")
+	if _, err := loadDefaults(fset); err != nil {
+		t.Fatal(err)
+	}
+	if err := fset.Parse([]string{"-lang=zig", "-lib=boost:174", "-lib=catch2:3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		name, got, want string
+	}{
+		{"lang", *lang, "zig"},                     // flag over env and config
+		{"args", *args, "-O2"},                     // env over config
+		{"compiler", *compiler, "from-config"},     // config over the default
+		{"server", *server, "https://godbolt.org"}, // the default
+		// Repeatable flags take the highest layer's values, not all of them
+		{"lib", libs.String(), "boost:174, catch2:3"},
+		{"header", headers.String(), "X-Two=2"},
+		{"override", overrides.String(), "stdlib=libc++"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("-%s = %q, want %q", c.name, c.got, c.want)
+		}
+	}
+	if f := fset.Lookup("compiler"); f.DefValue != "ztrunk" {
+		t.Errorf("-help would show default %q, want the built-in ztrunk", f.DefValue)
+	}
+}
+
+func TestConfigMissing(t *testing.T) {
+	fset := flag.NewFlagSet("cet", flag.ContinueOnError)
+	fset.String("compiler", "ztrunk", "")
+
+	t.Setenv("CET_CONFIG", filepath.Join(t.TempDir(), "missing.toml"))
+	if _, err := loadDefaults(fset); err == nil {
+		t.Error("a missing $CET_CONFIG file was not an error")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// diagnosticRe matches the "file:line:col: severity: message" prefix used by
+// GCC, Clang, Zig and most other compilers (the column is optional)
+var diagnosticRe = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)?\s*(fatal error|error|warning|note|remark):\s?(.*)$`)
+
+// diagnostic is a compiler message parsed from one stderr line
+type diagnostic struct {
+	File     string
+	Line     int
+	Column   int // 0 when the compiler reported none
+	Severity string
+	Message  string
+}
+
+// parseDiagnostic parses a diagnostic line, reporting false for anything else
+func parseDiagnostic(text string) (diagnostic, bool) {
+	m := diagnosticRe.FindStringSubmatch(text)
+	if m == nil {
+		return diagnostic{}, false
+	}
+	d := diagnostic{File: m[1], Severity: m[4], Message: m[5]}
+	d.Line, _ = strconv.Atoi(m[2])
+	d.Column, _ = strconv.Atoi(m[3])
+	return d, true
+}
+
+// severityColor is the color of a severity keyword: errors red, warnings yellow, the rest dimmed
+func severityColor(severity string) string {
+	switch severity {
+	case "error", "fatal error":
+		return "1;31"
+	case "warning":
+		return "1;33"
+	}
+	return "2"
+}
+
+// location is the diagnostic's file:line[:col] prefix
+func (d diagnostic) location() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+	}
+	return fmt.Sprintf("%s:%d", d.File, d.Line)
+}
+
+// isMainSource reports whether a diagnostic's file is the main source, which
+// the server saves as example.<ext> and some compilers call <source>
+func isMainSource(name string) bool {
+	base := path.Base(filepath.ToSlash(name))
+	return name == "<source>" || strings.TrimSuffix(base, path.Ext(base)) == "example"
+}
+
+// sourceLines returns the lines of the uploaded file a diagnostic refers to, or
+// nil if it is not one of them. The main file appears as <source> or
+// example.<ext>; project files by their path, possibly below a server-side
+// directory.
+func sourceLines(req CompileRequest, name string) []string {
+	if isMainSource(name) {
+		return splitLines(req.Source)
+	}
+	name = filepath.ToSlash(name)
+	for _, f := range req.Files {
+		file := filepath.ToSlash(f.Filename)
+		if name == file || strings.HasSuffix(name, "/"+strings.TrimPrefix(file, "./")) {
+			return splitLines(f.Contents)
+		}
+	}
+	return nil
+}
+
+// splitLines splits file contents into lines, without a phantom line after the final newline
+func splitLines(contents string) []string {
+	return strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+}
+
+// printContext prints the source line a diagnostic points at, with a caret
+// under its column. Lines outside the file are skipped.
+func printContext(w io.Writer, d diagnostic, lines []string) {
+	if d.Line < 1 || d.Line > len(lines) {
+		return
+	}
+	text := strings.TrimRight(lines[d.Line-1], "\r")
+	gutter := fmt.Sprintf("  %5d | ", d.Line)
+	fmt.Fprintln(w, colorize("2", gutter)+text)
+	if d.Column < 1 || d.Column > len(text)+1 {
+		return
+	}
+	// Keep tabs so the caret lines up with the text above
+	pad := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, text[:d.Column-1])
+	fmt.Fprintln(w, strings.Repeat(" ", len(gutter))+pad+colorize(severityColor(d.Severity), "^"))
+}
+
+// printDiagnostics prints compiler stderr with the severity of each diagnostic
+// colored. Notes and the context lines that follow a diagnostic (source
+// excerpts, carets) are indented beneath it; other lines, such as a trailing
+// "1 error generated.", print unchanged. Diagnostics in the main source are
+// labeled mainName rather than the server's name for it. With withContext,
+// each error and warning is followed by the uploaded source line it refers to.
+func printDiagnostics(w io.Writer, lines []OutputLine, req CompileRequest, mainName string, withContext bool) {
+	inDiagnostic := false
+	afterHeader := false // the previous line was an error or warning
+	for _, line := range lines {
+		d, ok := parseDiagnostic(line.Text)
+		file := d.File
+		if ok && mainName != stdinPath && isMainSource(d.File) {
+			d.File = mainName
+		}
+		// The line right after an error is its excerpt, which Zig prints unindented
+		if !ok && inDiagnostic && !afterHeader && !isContextLine(line.Text) {
+			inDiagnostic = false
+		}
+		afterHeader = false
+		switch {
+		case !ok && inDiagnostic:
+			fmt.Fprintln(w, "  "+line.Text)
+		case !ok:
+			fmt.Fprintln(w, line.Text)
+		case d.Severity == "note" || d.Severity == "remark":
+			fmt.Fprintln(w, colorize("2", "  "+d.location()+": "+d.Severity+": "+d.Message))
+		default:
+			inDiagnostic, afterHeader = true, true
+			fmt.Fprintln(w, colorize("1", d.location()+":")+" "+colorize(severityColor(d.Severity), d.Severity+":")+" "+d.Message)
+			if withContext {
+				printContext(w, d, sourceLines(req, file))
+			}
+		}
+	}
+}
+
+// isContextLine reports whether a line continues the diagnostic above it: an
+// indented source excerpt, or a caret or gutter line
+func isContextLine(text string) bool {
+	if text == "" {
+		return false
+	}
+	if text[0] == ' ' || text[0] == '\t' {
+		return true
+	}
+	return strings.ContainsAny(text[:1], "^~|")
+}
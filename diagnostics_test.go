@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		mainName string
+		stderr   []string
+		want     []string
+	}{
+		{
+			name:     "clang",
+			mainName: "main.c",
+			stderr: []string{
+				"<source>:3:5: error: use of undeclared identifier 'y'",
+				"    3 |     y = 1;",
+				"      |     ^",
+				"<source>:1:5: note: previous definition is here",
+				"1 error generated.",
+				"Compiler returned: 1",
+			},
+			want: []string{
+				"main.c:3:5: error: use of undeclared identifier 'y'",
+				"      3 |     y = 1;",
+				"        |     ^",
+				"  main.c:1:5: note: previous definition is here",
+				"1 error generated.",
+				"Compiler returned: 1",
+			},
+		},
+		{
+			name:     "zig prints the excerpt unindented",
+			mainName: "main.zig",
+			stderr: []string{
+				"example.zig:1:1: error: expected type",
+				"export fn f() void {",
+				"^~~~~~",
+				"",
+				"referenced by:",
+			},
+			want: []string{
+				"main.zig:1:1: error: expected type",
+				"  export fn f() void {",
+				"  ^~~~~~",
+				"",
+				"referenced by:",
+			},
+		},
+		{
+			name:     "output before the first diagnostic",
+			mainName: "main.c",
+			stderr: []string{
+				"In file included from <source>:1:",
+				"./util.h:2:1: warning: empty declaration",
+				"    2 | ;",
+				"compilation terminated.",
+			},
+			want: []string{
+				"In file included from <source>:1:",
+				"./util.h:2:1: warning: empty declaration",
+				"      2 | ;",
+				"compilation terminated.",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []OutputLine
+			for _, text := range tt.stderr {
+				lines = append(lines, OutputLine{Text: text})
+			}
+			var b strings.Builder
+			printDiagnostics(&b, lines, CompileRequest{}, tt.mainName, false)
+			if got, want := b.String(), strings.Join(tt.want, "\n")+"\n"; got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+type diffLine struct {
+	Op   diffOp
+	Text string
+}
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// diffAsm diffs the text of two assembly listings
+func diffAsm(a, b []AsmLine) []diffLine {
+	return diffLines(asmTexts(a), asmTexts(b))
+}
+
+func asmTexts(asm []AsmLine) []string {
+	texts := make([]string, len(asm))
+	for i, line := range asm {
+		texts[i] = strings.TrimRight(line.Text, " \t")
+	}
+	return texts
+}
+
+// diffLines computes a shortest edit script from a to b using Myers' O(ND) algorithm
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+
+	// trace[d] holds v[-(d+1)..d+1] as it was at the start of round d
+	var trace [][]int
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrack(trace [][]int, a, b []string) []diffLine {
+	var out []diffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			out = append(out, diffLine{diffEqual, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				out = append(out, diffLine{diffInsert, b[y-1]})
+			} else {
+				out = append(out, diffLine{diffDelete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// printDiff renders a unified diff with hunk headers, deletions in red and additions in green.
+// It returns whether any differences were found.
+func printDiff(w io.Writer, lines []diffLine, labelA, labelB string) bool {
+	fmt.Fprintln(w, colorize("31", "--- "+labelA))
+	fmt.Fprintln(w, colorize("32", "+++ "+labelB))
+
+	var changes []int
+	for i, l := range lines {
+		if l.Op != diffEqual {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(w, colorize("2", "(no differences)"))
+		return false
+	}
+
+	// Group changes that are close enough to share context into hunks
+	for i := 0; i < len(changes); {
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*diffContext+1 {
+			j++
+		}
+		start := max(0, changes[i]-diffContext)
+		end := min(len(lines), changes[j]+diffContext+1)
+		printHunk(w, lines, start, end)
+		i = j + 1
+	}
+	return true
+}
+
+func printHunk(w io.Writer, lines []diffLine, start, end int) {
+	// Line numbers of the hunk start in each listing
+	aLine, bLine := 1, 1
+	for _, l := range lines[:start] {
+		if l.Op != diffInsert {
+			aLine++
+		}
+		if l.Op != diffDelete {
+			bLine++
+		}
+	}
+	aCount, bCount := 0, 0
+	for _, l := range lines[start:end] {
+		if l.Op != diffInsert {
+			aCount++
+		}
+		if l.Op != diffDelete {
+			bCount++
+		}
+	}
+
+	fmt.Fprintln(w, colorize("36", fmt.Sprintf("@@ -%d,%d +%d,%d @@", aLine, aCount, bLine, bCount)))
+	for _, l := range lines[start:end] {
+		switch l.Op {
+		case diffDelete:
+			fmt.Fprintln(w, colorize("31", "-"+l.Text))
+		case diffInsert:
+			fmt.Fprintln(w, colorize("32", "+"+l.Text))
+		default:
+			fmt.Fprintln(w, " "+l.Text)
+		}
+	}
+}
+
+// compileDiff compiles the same source with two option sets and prints the assembly diff to w.
+// It returns the exit code of a failed compile (the second one's if both fail), else 0.
+func compileDiff(ctx context.Context, w io.Writer, optsA, optsB Options, labelA, labelB, filePath string) (int, error) {
+	source, err := readSource(filePath)
+	if err != nil {
+		return 0, err
+	}
+	// Both requests are checked against -max-source before either is uploaded
+	var reqs [2]CompileRequest
+	for i, opts := range []Options{optsA, optsB} {
+		p := prepareSource(opts, filePath, source)
+		if p.err != nil {
+			return 0, p.err
+		}
+		reqs[i] = p.req
+	}
+
+	// Both compiles run concurrently; requests are independent
+	var results [2]*CompileResponse
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, opts := range []Options{optsA, optsB} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _, errs[i] = fetch(ctx, opts, filePath, reqs[i])
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	code := 0
+	for i, result := range results {
+		for _, line := range result.Stderr {
+			fmt.Fprintln(w, colorize("31", line.Text))
+		}
+		if result.Code != 0 {
+			fmt.Fprintln(w, colorize("31", fmt.Sprintf("✗ %s failed (exit code %d)", []string{labelA, labelB}[i], result.Code)))
+			code = result.Code
+		}
+	}
+
+	fmt.Fprintln(w, "\n"+colorize("36", "━━━ Assembly Diff ━━━"))
+	printDiff(w, diffAsm(results[0].Asm, results[1].Asm), labelA, labelB)
+	return code, nil
+}
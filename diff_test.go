@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileDiffLines(t *testing.T) {
+	server := newFakeServer(t, func(CompileRequest) CompileResponse { return asmResponse("f:", "  ret") })
+	dir := t.TempDir()
+	writeFile(t, dir, "main.c", "int a;\nint f() { return 1; }\nint b;\n")
+
+	optsA := testOptions(server.Server)
+	optsA.Lines = lineRange{2, 2}
+	optsB := optsA
+	optsB.Args = "-O2"
+	var out bytes.Buffer
+	if _, err := compileDiff(context.Background(), &out, optsA, optsB, "-O0", "-O2", filepath.Join(dir, "main.c")); err != nil {
+		t.Fatal(err)
+	}
+	requests, _ := server.received()
+	if len(requests) != 2 {
+		t.Fatalf("server got %d requests, want 2", len(requests))
+	}
+	for _, req := range requests {
+		if req.Source != "int f() { return 1; }\n" {
+			t.Errorf("server got source %q, want only the -lines selection", req.Source)
+		}
+	}
+}
+
+func TestCompileDiffMaxSource(t *testing.T) {
+	server := newFakeServer(t, func(CompileRequest) CompileResponse { return asmResponse("f:", "  ret") })
+	dir := t.TempDir()
+	writeFile(t, dir, "main.c", "int f() { return 1; }\n")
+
+	optsA := testOptions(server.Server)
+	optsA.MaxSource = 5
+	optsB := optsA
+	optsB.Args = "-O2"
+	var out bytes.Buffer
+	if _, err := compileDiff(context.Background(), &out, optsA, optsB, "-O0", "-O2", filepath.Join(dir, "main.c")); err == nil || !strings.Contains(err.Error(), "-max-source") {
+		t.Errorf("got %v, want a -max-source error", err)
+	}
+	if requests, _ := server.received(); len(requests) != 0 {
+		t.Errorf("server got %d requests, want none", len(requests))
+	}
+}
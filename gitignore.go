@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A minimal .gitignore matcher: comments, negation, directory-only patterns,
+// anchoring and "**" are supported, which covers what projects typically use.
+
+type ignoreRule struct {
+	base    string // slash-separated directory of the .gitignore, relative to the walk root
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+type gitignore struct {
+	rules []ignoreRule
+}
+
+// load reads dir/.gitignore (if present); base is dir relative to the walk root
+func (g *gitignore) load(dir, base string) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		// A slash anywhere but the end anchors the pattern to the .gitignore's directory
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		expr := globToRegexp(line)
+		if !anchored {
+			expr = "(.*/)?" + expr
+		}
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			continue
+		}
+		rule.re = re
+		g.rules = append(g.rules, rule)
+	}
+}
+
+// ignored reports whether rel (slash-separated, relative to the walk root) is excluded.
+// Later rules take precedence, as in git.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range g.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		p := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			p = rel[len(r.base)+1:]
+		}
+		if r.re.MatchString(p) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// globToRegexp converts a gitignore glob to a regular expression body
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			if end := strings.IndexByte(glob[i:], ']'); end > 0 {
+				class := glob[i+1 : i+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + class + "]")
+				i += end
+			} else {
+				b.WriteString(regexp.QuoteMeta("["))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// compileGlobs compiles path globs such as "src/**/*.zig", which must match a
+// whole slash-separated path relative to the project root
+func compileGlobs(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile("^" + globToRegexp(strings.TrimPrefix(p, "/")) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// matchesAny reports whether rel matches one of the compiled globs
+func matchesAny(globs []*regexp.Regexp, rel string) bool {
+	for _, re := range globs {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// relSlash returns p relative to root in slash form ("" for root itself)
+func relSlash(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return path.Clean(filepath.ToSlash(rel))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestCollectProjectFilesGitignore(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, ".gitignore", "# generated\nbuild/\n*.gen.c\n!keep.gen.c\n")
+	writeFile(t, dir, "main.c", "int main() {}\n")
+	writeFile(t, dir, "util.c", "int util;\n")
+	writeFile(t, dir, "build/out.c", "int out;\n")
+	writeFile(t, dir, "src/build/nested.c", "int nested;\n") // build/ matches at any depth
+	writeFile(t, dir, "src/lib.c", "int lib;\n")
+	writeFile(t, dir, "src/table.gen.c", "int table;\n")
+	writeFile(t, dir, "src/keep.gen.c", "int keep;\n")
+	writeFile(t, dir, "vendor/.gitignore", "/skip.c\n")
+	writeFile(t, dir, "vendor/skip.c", "int skip;\n")
+	writeFile(t, dir, "vendor/sub/skip.c", "int subskip;\n") // anchored to vendor/
+
+	got := collectNames(t, dir, 0, io.Discard)
+	want := []string{"src/keep.gen.c", "src/lib.c", "util.c", "vendor/sub/skip.c"}
+	if !slices.Equal(got, want) {
+		t.Errorf("collected %q, want %q", got, want)
+	}
+}
@@ -3,8 +3,11 @@ module cet
 go 1.25.5
 
 require (
-	github.com/alecthomas/chroma/v2 v2.21.1 // indirect
+	github.com/alecthomas/chroma/v2 v2.21.1
+	github.com/fsnotify/fsnotify v1.9.0
+)
+
+require (
 	github.com/dlclark/regexp2 v1.11.5 // indirect
-	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 )
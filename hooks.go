@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// runHook runs a -on-success or -on-failure command through the shell after a
+// watch compile, under a header so its output stands apart from cet's. The
+// outcome is passed in CET_HOOK_CODE (-1 if no response arrived), CET_HOOK_FILE
+// and CET_HOOK_INSN_COUNT, named apart from the CET_* flag variables so that a
+// cet run by the hook does not take them as settings.
+func runHook(w, stderr io.Writer, name, command, filePath string, result *compileResult) {
+	code, insns := -1, 0
+	if result != nil {
+		code = result.ExitCode()
+		insns, _ = asmStats(result.Asm)
+	}
+
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/c"
+	}
+	cmd := exec.Command(shell, flag, command)
+	cmd.Env = append(os.Environ(),
+		"CET_HOOK_CODE="+strconv.Itoa(code),
+		"CET_HOOK_FILE="+filePath,
+		"CET_HOOK_INSN_COUNT="+strconv.Itoa(insns),
+	)
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+
+	fmt.Fprintln(w, "\n"+colorize("2", fmt.Sprintf("─── %s: %s ───", name, command)))
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintln(stderr, colorize("33", fmt.Sprintf("Warning: %s hook failed: %v", name, err)))
+	}
+}
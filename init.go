@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// initSkip are flags that run a one-off action rather than configure
+// compiles, so -init leaves them out of the config it writes
+var initSkip = map[string]bool{
+	"init": true, "force": true, "sample": true, "completion": true,
+	"list-compilers": true, "list-languages": true, "list-libs": true, "list-themes": true,
+}
+
+// initSamples are the sample sources -sample can write next to the config
+var initSamples = map[string]struct {
+	name, source, command string
+}{
+	"zig": {"main.zig", "export fn square(x: i32) i32 {\n    return x * x;\n}\n", "cet -once main.zig"},
+	"cpp": {"main.cpp", "int square(int x) {\n    return x * x;\n}\n", "cet -once -compiler=g132 main.cpp"},
+}
+
+// configTemplate is a config file listing every setting with its built-in
+// default, commented out so the file changes nothing until edited
+func configTemplate() string {
+	var b strings.Builder
+	b.WriteString("# cet configuration. Each key is named after a command-line flag; uncomment\n")
+	b.WriteString("# a line to change its default. -flags on the command line still win, and a\n")
+	b.WriteString("# .cet.toml in a project overrides this file for that project.\n")
+	b.WriteString("#\n# Settings can be grouped for -profile=<name> under a [profile.<name>] header:\n")
+	b.WriteString("#   [profile.arm]\n#   args = \"-O ReleaseFast -target aarch64-linux\"\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		if initSkip[f.Name] || hiddenFlags[f.Name] {
+			return
+		}
+		fmt.Fprintf(&b, "\n# %s\n# %s = %s\n", f.Usage, f.Name, configValue(f))
+	})
+	return b.String()
+}
+
+// configValue spells a flag's built-in default as a config value
+func configValue(f *flag.Flag) string {
+	if _, ok := f.Value.(*multiFlag); ok {
+		return "[]"
+	}
+	if getter, ok := f.Value.(flag.Getter); ok {
+		switch getter.Get().(type) {
+		case bool, int, int64, uint, uint64, float64:
+			return f.DefValue
+		}
+	}
+	return strconv.Quote(f.DefValue)
+}
+
+// writeNew writes a file, refusing to replace an existing one unless force is set
+func writeNew(path, contents string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists (use -force to overwrite it)", path)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(contents), 0o644)
+}
+
+// exitWithInit writes the config file for -init, and with sample a sample
+// source in the current directory, then exits
+func exitWithInit(stdout, stderr io.Writer, force bool, sample string) {
+	fail := func(err error) {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	s, ok := initSamples[sample]
+	if sample != "" && !ok {
+		fail(fmt.Errorf("unknown -sample %q (use zig or cpp)", sample))
+	}
+	path, _ := configPath()
+	if path == "" {
+		fail(errors.New("no config directory found (set $CET_CONFIG to choose the path)"))
+	}
+	if err := writeNew(path, configTemplate(), force); err != nil {
+		fail(err)
+	}
+	fmt.Fprintln(stdout, colorize("32", "Wrote "+path))
+
+	if sample != "" {
+		if err := writeNew(s.name, s.source, force); err != nil {
+			fail(err)
+		}
+		fmt.Fprintln(stdout, colorize("32", "Wrote "+s.name)+colorize("2", " (try: "+s.command+")"))
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"cet/ce"
+)
+
+type Compiler struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Lang string `json:"lang"`
+}
+
+// listCompilers prints the compilers available for lang, or every compiler grouped by language
+func listCompilers(w io.Writer, api *ce.Client, lang string) error {
+	path := "/api/compilers?fields=id,name,lang"
+	if lang != "" {
+		path = fmt.Sprintf("/api/compilers/%s?fields=id,name,lang", lang)
+	}
+
+	var compilers []Compiler
+	if err := api.GetJSON(context.Background(), path, &compilers); err != nil {
+		return err
+	}
+
+	byLang := map[string][]Compiler{}
+	var langs []string
+	for _, c := range compilers {
+		if _, ok := byLang[c.Lang]; !ok {
+			langs = append(langs, c.Lang)
+		}
+		byLang[c.Lang] = append(byLang[c.Lang], c)
+	}
+	sort.Strings(langs)
+
+	for i, l := range langs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, colorize("36", fmt.Sprintf("━━━ %s ━━━", l)))
+
+		group := byLang[l]
+		width := 0
+		for _, c := range group {
+			width = max(width, len(c.ID))
+		}
+		for _, c := range group {
+			fmt.Fprintf(w, "%-*s  %s\n", width, c.ID, c.Name)
+		}
+	}
+	return nil
+}
+
+type Language struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Extensions []string `json:"extensions"`
+}
+
+// listLanguages prints every language the server supports along with its file extensions
+func listLanguages(w io.Writer, api *ce.Client) error {
+	var languages []Language
+	if err := api.GetJSON(context.Background(), "/api/languages?fields=id,name,extensions", &languages); err != nil {
+		return err
+	}
+
+	sort.Slice(languages, func(i, j int) bool { return languages[i].ID < languages[j].ID })
+
+	idWidth, nameWidth := 0, 0
+	for _, l := range languages {
+		idWidth = max(idWidth, len(l.ID))
+		nameWidth = max(nameWidth, len(l.Name))
+	}
+	for _, l := range languages {
+		fmt.Fprintf(w, "%-*s  %-*s  %s\n", idWidth, l.ID, nameWidth, l.Name, strings.Join(l.Extensions, " "))
+	}
+	return nil
+}
+
+type LibraryInfo struct {
+	ID       string           `json:"id"`
+	Name     string           `json:"name"`
+	Versions []LibraryVersion `json:"versions"`
+}
+
+type LibraryVersion struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+}
+
+// listLibraries prints the libraries available for lang with the version IDs accepted by -lib
+func listLibraries(w io.Writer, api *ce.Client, lang string) error {
+	var libraries []LibraryInfo
+	if err := api.GetJSON(context.Background(), "/api/libraries/"+lang, &libraries); err != nil {
+		return err
+	}
+
+	sort.Slice(libraries, func(i, j int) bool { return libraries[i].ID < libraries[j].ID })
+
+	width := 0
+	for _, l := range libraries {
+		width = max(width, len(l.ID))
+	}
+	for _, l := range libraries {
+		versions := make([]string, 0, len(l.Versions))
+		for _, v := range l.Versions {
+			versions = append(versions, v.ID)
+		}
+		fmt.Fprintf(w, "%-*s  %s\n", width, l.ID, l.Name)
+		fmt.Fprintln(w, colorize("2", fmt.Sprintf("%-*s  %s", width, "", strings.Join(versions, " "))))
+	}
+	return nil
+}
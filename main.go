@@ -2,143 +2,399 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/alecthomas/chroma/v2"
 	"github.com/alecthomas/chroma/v2/formatters"
 	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/alecthomas/chroma/v2/styles"
 	"github.com/fsnotify/fsnotify"
+
+	"cet/ce"
 )
 
-// The Godbolt API accepts: "files": [{"filename": "helper.zig", "contents": "..."}]
+// The API types live in package ce; the CLI refers to them unqualified
+type (
+	FileEntry         = ce.FileEntry
+	CompileRequest    = ce.CompileRequest
+	CompileOptions    = ce.CompileOptions
+	CompilerOptions   = ce.CompilerOptions
+	Library           = ce.Library
+	Override          = ce.Override
+	ToolEntry         = ce.ToolEntry
+	PpOptions         = ce.PpOptions
+	IrOptions         = ce.IrOptions
+	ExecuteParameters = ce.ExecuteParameters
+	Filters           = ce.Filters
+	CompileResponse   = ce.CompileResponse
+	ToolResult        = ce.ToolResult
+	PpOutput          = ce.PpOutput
+	IrOutput          = ce.IrOutput
+	ExecResult        = ce.ExecResult
+	OutputLine        = ce.OutputLine
+	AsmLine           = ce.AsmLine
+	AsmSource         = ce.AsmSource
+	OptRemark         = ce.OptRemark
+	OptDebugLoc       = ce.OptDebugLoc
+	BuildStep         = ce.BuildStep
+)
 
-type FileEntry struct {
-	Filename string `json:"filename"`
-	Contents string `json:"contents"`
-}
+// Options holds the settings shared by compile and watch
+type Options struct {
+	Server         string
+	Compiler       string
+	Args           string
+	Style          *chroma.Style
+	Formatter      string // chroma formatter for the terminal's color depth
+	Lang           string
+	Filename       string
+	Filters        Filters
+	ShowSource     bool
+	Context        bool
+	ProjectRoot    string
+	SkipDirs       []string
+	FollowSymlinks bool
+	NoMultifile    bool
+	Include        []*regexp.Regexp // -include globs; empty includes everything
+	Exclude        []*regexp.Regexp
+	MaxSize        int64
+	MaxFileSize    int64
+	MaxSource      int64
+	Interleave     bool
+	Split          bool
+	Stats          bool
+	AsmLineNo      bool
+	Fold           bool
+	Tidy           bool
+	CMake          bool
+	CMakeArgs      string
+	ZigBuild       bool
+	Timing         bool
+	HighlightLine  int
+	Lines          lineRange
+	OptRemarks     bool
+	IR             bool
+	View           string
+	MCA            bool
+	Libraries      []Library
+	Overrides      []Override
+	ExtraFiles     []extraFile
+	ExtraOptions   map[string]any // -opt, merged into the request options
+	JSON           bool
+	Template       *template.Template
+	Quiet          bool
+	Link           bool
+	Open           bool
+	OutputFile     string
+	Baseline       string
+	SaveBaseline   bool
+	Copy           bool
 
-type CompileRequest struct {
-	Source  string         `json:"source"`
-	Options CompileOptions `json:"options"`
-	Files   []FileEntry    `json:"files,omitempty"`
-}
+	// Watch mode
+	Debounce   time.Duration
+	NoClear    bool
+	KeepErrors bool
+	WatchDiff  bool
+	OnSuccess  string
+	OnFailure  string
 
-type CompileOptions struct {
-	UserArguments string  `json:"userArguments"`
-	Filters       Filters `json:"filters"`
-}
+	previousAsm []AsmLine // last iteration's assembly, set by watch for -watch-diff
+	noSpinner   bool      // set by compileVariants, whose concurrent compiles would share the line
+
+	// Stderr receives warnings, progress notes and -verbose logs; regular
+	// output goes to the writer passed to compile and watch
+	Stderr io.Writer
+
+	// HTTP behavior
+	Verbose bool
+	API     *ce.Client // built once in main() and reused by every request
+
+	// Local response cache
+	NoCache       bool
+	ServerNoCache bool // also ask the server to skip its cache
+	CacheTTL      time.Duration
+	Offline       bool
+	DryRun        bool
 
-type Filters struct {
-	Binary      bool `json:"binary"`
-	CommentOnly bool `json:"commentOnly"`
-	Demangle    bool `json:"demangle"`
-	Directives  bool `json:"directives"`
-	Intel       bool `json:"intel"`
-	Labels      bool `json:"labels"`
-	Trim        bool `json:"trim"`
+	// Func limits the assembly to one function's body
+	Func         string
+	FuncFoldCase bool
+
+	// Grep limits the assembly to matching lines, with GrepBefore and
+	// GrepAfter lines of context around each
+	Grep       *regexp.Regexp
+	GrepBefore int
+	GrepAfter  int
+
+	// Execute mode only
+	Stdin    string
+	ProgArgs []string
 }
 
-type CompileResponse struct {
-	Code   int          `json:"code"`
-	Stdout []OutputLine `json:"stdout"`
-	Stderr []OutputLine `json:"stderr"`
-	Asm    []AsmLine    `json:"asm"`
+// colorEnabled is set from -color; by default only terminals without NO_COLOR get color
+var colorEnabled = true
+
+// colorize wraps text in the given SGR code (e.g. "31" for red) when color is enabled
+func colorize(code, text string) string {
+	if !colorEnabled {
+		return text
+	}
+	return "\033[" + code + "m" + text + "\033[0m"
 }
 
-type OutputLine struct {
-	Text string `json:"text"`
+// defaultSkipDirs are never searched for project files; -skip adds to this list
+var defaultSkipDirs = []string{".zig-cache", ".git", ".idea", "node_modules", "target", "zig-out"}
+
+// skipDirSet merges the default skip directories with user-supplied ones
+func skipDirSet(extra []string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range defaultSkipDirs {
+		set[name] = true
+	}
+	for _, name := range extra {
+		set[name] = true
+	}
+	return set
 }
 
-type AsmLine struct {
-	Text   string     `json:"text"`
-	Source *AsmSource `json:"source,omitempty"`
+// splitList parses a comma-separated flag value, dropping empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
 }
 
-type AsmSource struct {
-	File *string `json:"file"`
-	Line int     `json:"line"`
+// splitArgs splits s into arguments at unquoted whitespace, the way a shell
+// does: single quotes keep everything literally, double quotes keep spaces
+// but honor \\ and \", and a backslash elsewhere escapes the next character
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	switch {
+	case quote != 0:
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	case escaped:
+		return nil, errors.New("trailing backslash")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
 }
 
-func clearScreen() {
-	cmd := exec.Command("clear")
-	cmd.Stdout = os.Stdout
-	cmd.Run()
+// formatBytes renders a byte count for humans (e.g. "12.3 KB")
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
 }
 
-// collectProjectFiles gathers all source files from a directory for multi-file compilation
+// collectProjectFiles gathers all source files from a directory for multi-file compilation,
+// honoring .gitignore files at the search root and below
+// stderr: where skipped files are noted
 // searchDir: where to search for files (the -root flag or main file's directory)
 // mainFile: the main source file (absolute path)
 // relativeToDir: paths in output will be relative to this directory (usually main file's directory)
-func collectProjectFiles(searchDir string, mainFile string, relativeToDir string) ([]FileEntry, error) {
-	ext := filepath.Ext(mainFile)
+// extraSkip: directory names to skip in addition to defaultSkipDirs
+// include: which files to collect, by path relative to searchDir (see projectFileFilter)
+// maxFileSize: skip files larger than this many bytes, with a note (0 = no limit)
+// followSymlinks: descend into symlinked directories, which appear under the link's path
+// verbose: note each file skipped as binary
+func collectProjectFiles(stderr io.Writer, searchDir string, mainFile string, relativeToDir string, extraSkip []string, include func(rel string) bool, maxFileSize int64, followSymlinks bool, verbose bool) ([]FileEntry, error) {
 	var files []FileEntry
 
-	skipDirs := map[string]bool{
-		".zig-cache": true, ".git": true, ".idea": true,
-		"node_modules": true, "target": true, "zig-out": true,
-	}
+	skipDirs := skipDirSet(extraSkip)
 
-	err := filepath.WalkDir(searchDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
+	var ignore gitignore
+
+	// Canonical paths of the directories walked so far, so symlink cycles end
+	visited := map[string]bool{}
 
-		if d.IsDir() {
-			if skipDirs[d.Name()] {
-				return filepath.SkipDir
+	// walk visits the real directory dir, reporting paths as if under logicalDir
+	var walk func(dir, logicalDir string) error
+	walk = func(dir, logicalDir string) error {
+		return filepath.WalkDir(dir, func(realPath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			path := logicalDir
+			if sub, err := filepath.Rel(dir, realPath); err == nil && sub != "." {
+				path = filepath.Join(logicalDir, sub)
 			}
-			return nil
-		}
 
-		if filepath.Ext(path) != ext || path == mainFile || d.Name() == "build.zig" {
-			return nil
-		}
+			rel := relSlash(searchDir, path)
+			isDir := d.IsDir()
+			isLink := d.Type()&fs.ModeSymlink != 0
+			if followSymlinks && isLink {
+				info, err := os.Stat(realPath)
+				if err != nil {
+					return nil // dangling link
+				}
+				isDir = info.IsDir()
+			}
 
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
+			if isDir {
+				// SkipDir on a link (not a directory to WalkDir) would skip its siblings
+				skip := filepath.SkipDir
+				if isLink {
+					skip = nil
+				}
+				if skipDirs[d.Name()] || (rel != "" && ignore.ignored(rel, true)) {
+					return skip
+				}
+				if followSymlinks && realPath != dir {
+					canonical, err := filepath.EvalSymlinks(realPath)
+					if err != nil || visited[canonical] {
+						return skip
+					}
+					visited[canonical] = true
+					if isLink {
+						return walk(canonical, path)
+					}
+				}
+				ignore.load(realPath, rel)
+				return nil
+			}
 
-		// Make path relative to the main file's directory (how Zig resolves imports)
-		relPath, err := filepath.Rel(relativeToDir, path)
-		if err != nil {
-			return err
-		}
+			if !include(rel) || path == mainFile {
+				return nil
+			}
+			if ignore.ignored(rel, false) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if isLink && followSymlinks {
+				info, err = os.Stat(realPath)
+			}
+			if err == nil && maxFileSize > 0 && info.Size() > maxFileSize {
+				fmt.Fprintln(stderr, colorize("33", fmt.Sprintf("Skipping %s: %s exceeds the -max-file-size limit of %s",
+					rel, formatBytes(info.Size()), formatBytes(maxFileSize))))
+				return nil
+			}
+
+			content, err := os.ReadFile(realPath)
+			if err != nil {
+				return err
+			}
+			// A matching extension doesn't make a file text, and the request is JSON
+			if bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content) {
+				if verbose {
+					fmt.Fprintln(stderr, colorize("2", fmt.Sprintf("Skipping %s: binary or not UTF-8", rel)))
+				}
+				return nil
+			}
+
+			// Make path relative to the main file's directory (how Zig resolves imports),
+			// with forward slashes as the server expects even on Windows
+			relPath, err := filepath.Rel(relativeToDir, path)
+			if err != nil {
+				return err
+			}
 
-		files = append(files, FileEntry{
-			Filename: relPath,
-			Contents: string(content),
+			files = append(files, FileEntry{
+				Filename: slashName(relPath, filepath.Separator),
+				Contents: string(content),
+			})
+			return nil
 		})
-		return nil
-	})
+	}
 
+	if canonical, err := filepath.EvalSymlinks(searchDir); err == nil {
+		visited[canonical] = true
+	}
+	err := walk(searchDir, searchDir)
 	return files, err
 }
 
-func highlight(code, language string) string {
+// slashName converts a relative path using the OS separator sep to the
+// forward-slash name the server expects (filepath.ToSlash, testable off Windows)
+func slashName(rel string, sep byte) string {
+	if sep == '/' {
+		return rel
+	}
+	return strings.ReplaceAll(rel, string(sep), "/")
+}
+
+// highlight colors code with the given style and chroma formatter (see terminalFormatter)
+func highlight(code, language string, style *chroma.Style, formatterName string) string {
+	if !colorEnabled {
+		return code
+	}
+
 	lexer := lexers.Get(language)
 	if lexer == nil {
 		lexer = lexers.Fallback
 	}
 	lexer = chroma.Coalesce(lexer)
 
-	style := styles.Get("gruvbox")
 	if style == nil {
 		style = styles.Fallback
 	}
 
-	formatter := formatters.Get("terminal256")
+	formatter := formatters.Get(formatterName)
 	if formatter == nil {
 		formatter = formatters.Fallback
 	}
@@ -156,237 +412,2042 @@ func highlight(code, language string) string {
 	return buf.String()
 }
 
-func getLangFromFile(filePath string) string {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	switch ext {
-	case ".zig":
-		return "zig"
-	case ".c":
-		return "c"
-	case ".cpp", ".cc", ".cxx":
-		return "cpp"
-	case ".rs":
-		return "rust"
-	case ".go":
-		return "go"
-	case ".py":
-		return "python"
-	default:
-		return ""
+// loadStyle reads a chroma XML style definition, as produced by chroma's style export
+func loadStyle(path string) (*chroma.Style, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read style file: %w", err)
 	}
-}
+	defer f.Close()
 
-func compile(baseURL, compiler, filePath, args string, showSource bool, projectRoot string) error {
-	source, err := os.ReadFile(filePath)
+	style, err := chroma.NewXMLStyle(f)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return nil, fmt.Errorf("invalid style file %s: %w", path, err)
 	}
+	return style, nil
+}
 
-	// Show highlighted source if requested
-	if showSource {
-		lang := getLangFromFile(filePath)
-		fmt.Println("\033[36m━━━ Source ━━━\033[0m")
-		fmt.Println(highlight(string(source), lang))
+// langByExt maps lowercase file extensions to chroma lexer names
+var langByExt = map[string]string{
+	".zig":   "zig",
+	".c":     "c",
+	".cpp":   "cpp",
+	".cc":    "cpp",
+	".cxx":   "cpp",
+	".h":     "cpp",
+	".hpp":   "cpp",
+	".hxx":   "cpp",
+	".cu":    "cpp", // chroma has no CUDA lexer; C++ is the closest match
+	".cuh":   "cpp",
+	".s":     "gas", // also covers .S, extensions are lowercased
+	".asm":   "gas",
+	".ll":    "llvm",
+	".rs":    "rust",
+	".go":    "go",
+	".py":    "python",
+	".d":     "d",
+	".swift": "swift",
+	".kt":    "kotlin",
+	".f90":   "fortran",
+	".jl":    "julia",
+	".hs":    "haskell",
+	".nim":   "nim",
+	".cs":    "csharp",
+	".java":  "java",
+}
+
+// sourceName is the logical name of the main source: -filename, or the base
+// name of the file
+func sourceName(opts Options, filePath string) string {
+	if opts.Filename != "" {
+		return opts.Filename
 	}
+	return filepath.Base(filePath)
+}
 
-	// Collect additional project files for multi-file compilation
-	absPath, err := filepath.Abs(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+// getLangFromFile returns the chroma lexer name for a file, or override when one is given
+func getLangFromFile(filePath, override string) string {
+	if override != "" {
+		return override
 	}
-	mainDir := filepath.Dir(absPath)
+	return langByExt[strings.ToLower(filepath.Ext(filePath))]
+}
 
-	// Determine search directory: use -root flag if provided, otherwise use main file's directory
-	var searchDir string
-	if projectRoot != "" {
-		searchDir, err = filepath.Abs(projectRoot)
+// newHTTPClient builds the client shared by every request. Proxies come from
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY unless proxyURL (http, https or socks5) is given.
+func newHTTPClient(timeout time.Duration, proxyURL string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	// Saves in watch mode can be minutes apart; keep the connection warm so
+	// each recompile skips the TCP/TLS handshake
+	transport.IdleConnTimeout = 5 * time.Minute
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
 		if err != nil {
-			return fmt.Errorf("failed to get absolute project root: %w", err)
+			return nil, fmt.Errorf("invalid -proxy: %w", err)
 		}
-	} else {
-		searchDir = mainDir
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported -proxy scheme %q (use http, https or socks5)", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
 	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
 
-	// Search from searchDir, but paths are relative to mainDir (how Zig resolves @import)
-	projectFiles, err := collectProjectFiles(searchDir, absPath, mainDir)
-	if err != nil {
-		fmt.Printf("\033[33mWarning: could not collect project files: %v\033[0m\n", err)
-		projectFiles = nil // Continue with just the main file
+// filterFlags defines the assembly filter flags on fset, with defaults matching
+// Compiler Explorer's usual view, and returns a function that reads them back
+// once fset is parsed
+func filterFlags(fset *flag.FlagSet) func() Filters {
+	intel := fset.Bool("intel", true, "Use Intel syntax (-intel=false for AT&T)")
+	labels := fset.Bool("labels", true, "Filter unused labels")
+	directives := fset.Bool("directives", true, "Filter assembler directives")
+	comments := fset.Bool("comments", true, "Filter comment-only lines")
+	demangle := fset.Bool("demangle", true, "Demangle symbol names")
+	trim := fset.Bool("trim", false, "Trim whitespace in assembly")
+	binary := fset.Bool("binary", false, "Compile to binary and disassemble")
+	return func() Filters {
+		return Filters{
+			Binary:      *binary,
+			CommentOnly: *comments,
+			Demangle:    *demangle,
+			Directives:  *directives,
+			Intel:       *intel,
+			Labels:      *labels,
+			Trim:        *trim,
+		}
 	}
+}
 
-	req := CompileRequest{
-		Source: string(source),
-		Files:  projectFiles,
-		Options: CompileOptions{
-			UserArguments: args,
-			Filters: Filters{
-				Binary:      false,
-				CommentOnly: true,
-				Demangle:    true,
-				Directives:  true,
-				Intel:       true,
-				Labels:      true,
-				Trim:        false,
-			},
-		},
+// newAPIClient builds the Compiler Explorer client shared by every request,
+// logging requests and responses for -verbose and announcing retries on stderr
+func newAPIClient(stderr io.Writer, server string, client *http.Client, headers http.Header, retries int, noGzip, verbose bool) *ce.Client {
+	api := ce.NewClient(server)
+	api.HTTP = client
+	api.Header = headers
+	api.Retries = retries
+	if noGzip {
+		api.GzipThreshold = 0
 	}
+	return reportingTo(api, stderr, verbose)
+}
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+// reportingTo returns a copy of api that announces retries, and with verbose
+// logs requests and responses, on stderr
+func reportingTo(api *ce.Client, stderr io.Writer, verbose bool) *ce.Client {
+	c := *api
+	c.OnRetry = func(err error, backoff time.Duration, attempt int) {
+		fmt.Fprintln(stderr, colorize("33", fmt.Sprintf("%v, retrying in %s... (%d/%d)", err, backoff, attempt, c.Retries)))
 	}
+	c.OnRequest, c.OnResponse = nil, nil
+	if verbose {
+		c.OnRequest = func(req *http.Request, body []byte) { logRequest(stderr, req, body) }
+		c.OnResponse = func(resp *http.Response, body []byte) { logResponse(stderr, resp, body) }
+	}
+	return &c
+}
 
-	url := fmt.Sprintf("%s/api/compiler/%s/compile", baseURL, compiler)
+// multiFlag collects the values of a repeatable flag. Values from a higher
+// settings layer replace those from the layers below (see startLayer).
+type multiFlag struct {
+	values  []string
+	replace bool // the next Set starts over
+}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+func (m *multiFlag) String() string { return strings.Join(m.values, ", ") }
+
+func (m *multiFlag) Set(v string) error {
+	if m.replace {
+		m.values, m.replace = nil, false
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Accept", "application/json")
+	m.values = append(m.values, v)
+	return nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+// buildHeaders turns -header key=value pairs and an optional bearer token into request headers
+func buildHeaders(pairs []string, token string) (http.Header, error) {
+	headers := http.Header{}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid -header %q, expected key=value", pair)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if token != "" {
+		headers.Set("Authorization", "Bearer "+token)
 	}
-	defer resp.Body.Close()
+	return headers, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+// parseOverrides turns -override key=value values into request overrides
+func parseOverrides(specs []string) ([]Override, error) {
+	var overrides []Override
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid -override %q, expected key=value", spec)
+		}
+		overrides = append(overrides, Override{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
 	}
+	return overrides, nil
+}
 
-	var result CompileResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return fmt.Errorf("failed to parse response: %w\nBody: %s", err, string(body[:min(500, len(body))]))
+// parseRequestOptions turns -opt path=value values into extra request options.
+// A value that parses as JSON (true, 8, "x", [1], {...}) is sent as that;
+// anything else is sent as a string.
+func parseRequestOptions(specs []string) (map[string]any, error) {
+	options := make(map[string]any)
+	for _, spec := range specs {
+		key, raw, ok := strings.Cut(spec, "=")
+		if !ok || slices.Contains(strings.Split(key, "."), "") {
+			return nil, fmt.Errorf("invalid -opt %q, expected path=value (e.g. compilerOptions.skipAsm=true)", spec)
+		}
+		var value any
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		options[key] = value
 	}
+	return options, nil
+}
 
-	// Print stderr if any
-	for _, line := range result.Stderr {
-		fmt.Printf("\033[31m%s\033[0m\n", line.Text)
+// extraFile is a -file upload: the file at path, sent under the logical name
+type extraFile struct {
+	path string
+	name string
+}
+
+// parseExtraFiles turns -file path=name values into extra files; a bare path
+// is sent under its base name
+func parseExtraFiles(specs []string) ([]extraFile, error) {
+	var files []extraFile
+	for _, spec := range specs {
+		path, name, ok := strings.Cut(spec, "=")
+		if !ok {
+			name = filepath.Base(path)
+		}
+		name = filepath.ToSlash(filepath.Clean(name))
+		if path == "" || name == "." || name == "/" {
+			return nil, fmt.Errorf("invalid -file %q, expected path=name", spec)
+		}
+		files = append(files, extraFile{path: path, name: name})
+	}
+	return files, nil
+}
+
+// mergeFiles adds the -file uploads to the collected project files, replacing
+// any collected file with the same logical name
+func mergeFiles(collected []FileEntry, extra []extraFile) ([]FileEntry, error) {
+	if len(extra) == 0 {
+		return collected, nil
+	}
+	explicit := make(map[string]bool, len(extra))
+	var files []FileEntry
+	for _, f := range extra {
+		content, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read -file: %w", err)
+		}
+		if explicit[f.name] {
+			return nil, fmt.Errorf("-file name %s given more than once", f.name)
+		}
+		explicit[f.name] = true
+		files = append(files, FileEntry{Filename: f.name, Contents: string(content)})
 	}
+	merged := make([]FileEntry, 0, len(collected)+len(files))
+	for _, f := range collected {
+		if !explicit[f.Filename] {
+			merged = append(merged, f)
+		}
+	}
+	return append(merged, files...), nil
+}
 
-	// Print stdout if any
-	for _, line := range result.Stdout {
-		fmt.Println(line.Text)
+// parseLibraries turns -lib id:version values into request libraries
+func parseLibraries(specs []string) ([]Library, error) {
+	var libs []Library
+	for _, spec := range specs {
+		id, version, ok := strings.Cut(spec, ":")
+		if !ok || id == "" || version == "" {
+			return nil, fmt.Errorf("invalid -lib %q, expected id:version (see -list-libs)", spec)
+		}
+		libs = append(libs, Library{ID: id, Version: version})
 	}
+	return libs, nil
+}
+
+// sensitiveHeaders are redacted from -verbose output
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"X-Api-Key":           true,
+}
 
-	// Print assembly with syntax highlighting
-	if len(result.Asm) > 0 {
-		fmt.Println("\n\033[36m━━━ Assembly ━━━\033[0m")
-		var asmBuilder strings.Builder
-		for _, line := range result.Asm {
-			asmBuilder.WriteString(line.Text)
-			asmBuilder.WriteString("\n")
+// logRequest prints the outgoing request to stderr for -verbose
+func logRequest(stderr io.Writer, req *http.Request, body []byte) {
+	fmt.Fprintln(stderr, colorize("2", fmt.Sprintf("→ %s %s", req.Method, req.URL)))
+	for name, values := range req.Header {
+		value := strings.Join(values, ", ")
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			value = "<redacted>"
 		}
-		fmt.Print(highlight(asmBuilder.String(), "gas"))
+		fmt.Fprintln(stderr, colorize("2", fmt.Sprintf("  %s: %s", name, value)))
+	}
+	if len(body) > 0 {
+		fmt.Fprintln(stderr, colorize("2", string(body)))
 	}
+}
 
-	return nil
+// logResponse prints the response status and raw body to stderr for -verbose
+func logResponse(stderr io.Writer, resp *http.Response, body []byte) {
+	fmt.Fprintln(stderr, colorize("2", fmt.Sprintf("← %s", resp.Status)))
+	fmt.Fprintln(stderr, colorize("2", string(body)))
 }
 
-func watch(baseURL, compiler, filePath, args string, showSource bool, projectRoot string) error {
-	watcher, err := fsnotify.NewWatcher()
+// projectFileFilter decides which files are uploaded with mainFile, given their
+// slash-separated path relative to searchDir: those with the same extension, or
+// a CMake project's sources and build scripts, narrowed by -include and -exclude.
+// Zig build scripts are only included with -zig-build and one at searchDir.
+func projectFileFilter(opts Options, mainFile, searchDir string) func(rel string) bool {
+	ext := filepath.Ext(mainFile)
+	withBuild := opts.ZigBuild && ext == ".zig" && hasZigBuild(searchDir)
+	byName := func(name string) bool {
+		if opts.CMake {
+			return isCMakeProjectFile(name)
+		}
+		if name == "build.zig" || name == "build.zig.zon" {
+			return withBuild
+		}
+		return filepath.Ext(name) == ext
+	}
+	return func(rel string) bool {
+		if !byName(path.Base(rel)) {
+			return false
+		}
+		if len(opts.Include) > 0 && !matchesAny(opts.Include, rel) {
+			return false
+		}
+		return !matchesAny(opts.Exclude, rel)
+	}
+}
+
+// hasZigBuild reports whether dir holds a build.zig
+func hasZigBuild(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "build.zig"))
+	return err == nil && !info.IsDir()
+}
+
+// findZigBuildRoot returns the nearest directory at or above dir with a build.zig
+func findZigBuildRoot(dir string) (string, bool) {
+	for {
+		if hasZigBuild(dir) {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// projectSearchDir determines where project files are searched for mainFile
+// (an absolute path): the -root flag if provided, else the CMake project or,
+// with -zig-build, the Zig build root around it, else the main file's directory
+func projectSearchDir(opts Options, mainFile string) (string, error) {
+	mainDir := filepath.Dir(mainFile)
+	if opts.ProjectRoot == "" && opts.CMake {
+		return findCMakeRoot(mainDir)
+	}
+	if opts.ProjectRoot == "" && opts.ZigBuild && filepath.Ext(mainFile) == ".zig" {
+		if dir, ok := findZigBuildRoot(mainDir); ok {
+			return dir, nil
+		}
+	}
+	if opts.ProjectRoot == "" {
+		return mainDir, nil
+	}
+	dir, err := filepath.Abs(opts.ProjectRoot)
 	if err != nil {
-		return fmt.Errorf("failed to create watcher: %w", err)
+		return "", fmt.Errorf("failed to get absolute project root: %w", err)
 	}
-	defer watcher.Close()
+	return dir, nil
+}
+
+// stdinPath as the file argument reads the source from standard input
+const stdinPath = "-"
 
-	absPath, err := filepath.Abs(filePath)
+// readSource reads the main source file, or standard input for "-"
+func readSource(filePath string) ([]byte, error) {
+	var source []byte
+	var err error
+	if filePath == stdinPath {
+		source, err = io.ReadAll(os.Stdin)
+	} else {
+		source, err = os.ReadFile(filePath)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	return source, nil
+}
 
-	dir := filepath.Dir(absPath)
-	if err := watcher.Add(dir); err != nil {
-		return fmt.Errorf("failed to watch directory: %w", err)
+// buildRequest assembles the compile request for source, collecting project files
+// from disk for multi-file compilation (not for stdin or -no-multifile) and adding -file uploads
+func buildRequest(opts Options, filePath string, source []byte) (CompileRequest, error) {
+	// Standard input has no name of its own, so only -filename names it
+	name := opts.Filename
+	if filePath != stdinPath {
+		name = sourceName(opts, filePath)
+	}
+	if opts.CMake {
+		name = cmakeListsName
 	}
 
-	fmt.Printf("\033[34m⚡ Watching %s\033[0m\n", filePath)
-	fmt.Printf("\033[34m   Compiler: %s\033[0m\n", compiler)
-	fmt.Printf("\033[34m   Args: %s\033[0m\n", args)
-	fmt.Printf("\033[34m   Server: %s\033[0m\n\n", baseURL)
+	var projectFiles []FileEntry
+	if filePath != stdinPath && !opts.NoMultifile {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return CompileRequest{}, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		mainDir := filepath.Dir(absPath)
 
-	// Initial compile
-	if err := compile(baseURL, compiler, filePath, args, showSource, projectRoot); err != nil {
-		fmt.Printf("\033[31mError: %v\033[0m\n", err)
+		searchDir, err := projectSearchDir(opts, absPath)
+		if err != nil {
+			return CompileRequest{}, err
+		}
+
+		// CMake builds from the project root, with CMakeLists.txt as the source
+		if opts.CMake {
+			absPath, mainDir = filepath.Join(searchDir, cmakeListsName), searchDir
+			if source, err = os.ReadFile(absPath); err != nil {
+				return CompileRequest{}, fmt.Errorf("failed to read %s: %w", cmakeListsName, err)
+			}
+		}
+
+		// Search from searchDir, but paths are relative to mainDir (how Zig resolves @import)
+		projectFiles, err = collectProjectFiles(opts.Stderr, searchDir, absPath, mainDir, opts.SkipDirs, projectFileFilter(opts, absPath, searchDir), opts.MaxFileSize, opts.FollowSymlinks, opts.Verbose)
+		if err != nil {
+			fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("Warning: could not collect project files: %v", err)))
+			projectFiles = nil // Continue with just the main file
+		}
 	}
 
-	// Debounce timer
-	var debounce *time.Timer
+	// -file uploads apply to stdin too, and win over collected files of the same
+	// name; the main source's name is taken by the source itself
+	for _, f := range opts.ExtraFiles {
+		if f.name == name {
+			return CompileRequest{}, fmt.Errorf("-file name %s is the main source's name (see -filename)", f.name)
+		}
+	}
+	projectFiles = slices.DeleteFunc(projectFiles, func(f FileEntry) bool { return f.Filename == name })
+	projectFiles, err := mergeFiles(projectFiles, opts.ExtraFiles)
+	if err != nil {
+		return CompileRequest{}, err
+	}
 
-	for {
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return nil
-			}
-			if event.Name == absPath && (event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create) {
-				if debounce != nil {
-					debounce.Stop()
-				}
-				debounce = time.AfterFunc(100*time.Millisecond, func() {
-					clearScreen()
-					fmt.Printf("\033[34m⚡ %s — %s\033[0m\n\n", filePath, time.Now().Format("15:04:05"))
-					if err := compile(baseURL, compiler, filePath, args, showSource, projectRoot); err != nil {
-						fmt.Printf("\033[31mError: %v\033[0m\n", err)
-					}
-				})
-			}
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return nil
-			}
-			fmt.Printf("\033[31mWatcher error: %v\033[0m\n", err)
+	var total int64
+	for _, f := range projectFiles {
+		total += int64(len(f.Contents))
+	}
+	if opts.MaxSize > 0 && total > opts.MaxSize {
+		return CompileRequest{}, fmt.Errorf("project files total %s, exceeding the -max-size limit of %s (raise -max-size or narrow -root)",
+			formatBytes(total), formatBytes(opts.MaxSize))
+	}
+
+	req := CompileRequest{
+		Source:   string(source),
+		Filename: name,
+		Files:    projectFiles,
+		Options: CompileOptions{
+			UserArguments: opts.Args,
+			Filters:       opts.Filters,
+			CompilerOptions: CompilerOptions{
+				ProduceOptInfo: opts.OptRemarks,
+				CmakeArgs:      opts.CMakeArgs,
+			},
+		},
+	}
+	if v := views[opts.View]; v.request != nil {
+		v.request(&req.Options.CompilerOptions)
+	}
+	if opts.IR {
+		req.Options.CompilerOptions.ProduceIr = &IrOptions{
+			FilterDebugInfo:     true,
+			FilterIRMetadata:    true,
+			FilterAttributes:    true,
+			FilterComments:      opts.Filters.CommentOnly,
+			NoDiscardValueNames: true,
+			Demangle:            opts.Filters.Demangle,
+		}
+	}
+	req.Options.Libraries = opts.Libraries
+	req.Options.Overrides = opts.Overrides
+	if opts.MCA {
+		req.Options.Tools = append(req.Options.Tools, ToolEntry{ID: mcaToolID})
+	}
+	if opts.Filters.Execute {
+		req.Options.ExecuteParameters = &ExecuteParameters{
+			Args:  opts.ProgArgs,
+			Stdin: opts.Stdin,
 		}
 	}
+	req.Options.Extra = opts.ExtraOptions
+	if opts.ServerNoCache {
+		req.BypassCache = ce.BypassCompilation
+	}
+	return req, nil
 }
 
-func main() {
-	var (
-		server      = flag.String("server", "https://godbolt.org", "Compiler Explorer server URL")
-		compiler    = flag.String("compiler", "ztrunk", "Compiler ID (e.g., ztrunk, z0140, g141, clang1910)")
-		args        = flag.String("args", "", "Compiler arguments (e.g., '-O ReleaseFast -target aarch64-macos')")
-		once        = flag.Bool("once", false, "Compile once and exit (don't watch)")
-		showSource  = flag.Bool("source", false, "Show highlighted source code")
-		projectRoot = flag.String("root", "", "Project root for multi-file imports (default: file's directory)")
-	)
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "cet - Compiler Explorer Terminal\n\n")
-		fmt.Fprintf(os.Stderr, "Usage: cet [options] <file>\n\n")
-		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nExamples:\n")
-		fmt.Fprintf(os.Stderr, "  cet -args='-O ReleaseFast -target aarch64-macos -mcpu=apple_m4' main.zig\n")
-		fmt.Fprintf(os.Stderr, "  cet -compiler=g132 -args='-O3' main.c\n")
-		fmt.Fprintf(os.Stderr, "  cet -once -source main.zig\n")
-		fmt.Fprintf(os.Stderr, "  cet -root=. src/main.zig   # Multi-file project with imports from repo root\n")
+// compileURL is the endpoint compile requests are posted to
+func compileURL(opts Options) string {
+	return opts.Server + ce.CompilePath(opts.Compiler, opts.CMake)
+}
+
+// fetch sends req to the server (or serves it from the response cache) and
+// parses the response, reporting whether it came from the cache
+func fetch(ctx context.Context, opts Options, filePath string, req CompileRequest) (*CompileResponse, bool, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal request: %w", err)
 	}
-	flag.Parse()
 
-	if flag.NArg() < 1 {
-		flag.Usage()
-		os.Exit(1)
+	url := compileURL(opts)
+
+	// Serve from the local response cache when possible
+	key := cacheKey(url, jsonData)
+	source := filePath
+	if abs, err := filepath.Abs(filePath); err == nil && filePath != stdinPath {
+		source = abs
+	}
+	latest := latestKey(url, source, opts.Args)
+	var body []byte
+	cached := false
+	if opts.Offline {
+		// Offline: the newest response for this file, even if the source has changed since
+		body, err = cacheLatest(latest, filePath, opts.CacheTTL)
+		if err != nil {
+			return nil, false, err
+		}
+		cached = true
+	} else if !opts.NoCache {
+		body, cached = cacheGet(key, opts.CacheTTL)
+		if cached && opts.Verbose {
+			fmt.Fprintln(opts.Stderr, colorize("2", fmt.Sprintf("Using cached response %s", key)))
+		}
+	}
+	if !cached {
+		body, err = opts.API.PostJSON(ctx, ce.CompilePath(opts.Compiler, opts.CMake), jsonData)
+		if err != nil {
+			return nil, false, err
+		}
 	}
 
-	filePath := flag.Arg(0)
+	result, err := ce.ParseResponse(body)
+	if err != nil {
+		return nil, false, err
+	}
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Error: file %s does not exist\n", filePath)
-		os.Exit(1)
+	if !opts.Offline && !opts.NoCache {
+		var err error
+		if !cached {
+			err = cachePut(key, body)
+		}
+		if err == nil {
+			err = cachePutLatest(latest, key)
+		}
+		if err != nil {
+			fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("Warning: could not write response cache: %v", err)))
+		}
 	}
 
-	if *once {
-		if err := compile(*server, *compiler, filePath, *args, *showSource, *projectRoot); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	// Narrow the assembly down to a single function if requested
+	// (-fold does its own matching, expanding the function in place instead)
+	if opts.Func != "" && !opts.Fold && len(result.Asm) > 0 {
+		result.Asm = filterFunction(result.Asm, opts.Func, opts.FuncFoldCase)
+		if len(result.Asm) == 0 {
+			fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("No function label matching %q found in the assembly", opts.Func)))
+		}
+	}
+
+	if opts.Tidy {
+		result.Asm = tidyAsm(result.Asm)
+	}
+
+	if opts.Grep != nil && len(result.Asm) > 0 {
+		result.Asm = grepAsm(result.Asm, opts.Grep, opts.GrepBefore, opts.GrepAfter)
+		if len(result.Asm) == 0 {
+			fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("No assembly line matches -grep %q", opts.Grep)))
+		}
+	}
+
+	return result, cached, nil
+}
+
+// prepared is a file's source and the compile request built from it
+type prepared struct {
+	source []byte
+	req    CompileRequest
+	err    error
+}
+
+// lineRange selects lines start through end of a file (zero value = all lines)
+type lineRange struct {
+	start, end int
+}
+
+// parseLineRange parses a -lines START:END range of 1-based, inclusive line numbers
+func parseLineRange(s string) (lineRange, error) {
+	startText, endText, ok := strings.Cut(s, ":")
+	start, err1 := strconv.Atoi(startText)
+	end, err2 := strconv.Atoi(endText)
+	if !ok || err1 != nil || err2 != nil {
+		return lineRange{}, fmt.Errorf("invalid -lines %q, expected START:END", s)
+	}
+	if start < 1 || end < start {
+		return lineRange{}, fmt.Errorf("invalid -lines %q: lines are numbered from 1 and START must not exceed END", s)
+	}
+	return lineRange{start, end}, nil
+}
+
+// slice returns the selected lines of source
+func (r lineRange) slice(source []byte) ([]byte, error) {
+	if r.start == 0 {
+		return source, nil
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(string(source), "\n"), "\n")
+	if r.end > len(lines) {
+		return nil, fmt.Errorf("-lines %d:%d is out of range (the file has %d lines)", r.start, r.end, len(lines))
+	}
+	return []byte(strings.Join(lines[r.start-1:r.end], "")), nil
+}
+
+// prepare reads the file and builds its compile request
+func prepare(opts Options, filePath string) prepared {
+	source, err := readSource(filePath)
+	if err != nil {
+		return prepared{err: err}
+	}
+	return prepareSource(opts, filePath, source)
+}
+
+// prepareSource is prepare for source already read from filePath, so several
+// requests can share one read (stdin can only be read once)
+func prepareSource(opts Options, filePath string, source []byte) prepared {
+	source, err := opts.Lines.slice(source)
+	// Checked apart from -max-size, which only covers the collected project files
+	if err == nil && opts.MaxSource > 0 && int64(len(source)) > opts.MaxSource {
+		err = fmt.Errorf("%s is %s, exceeding the -max-source limit of %s (raise -max-source or compile part of it with -lines)",
+			filePath, formatBytes(int64(len(source))), formatBytes(opts.MaxSource))
+	}
+	if err != nil {
+		return prepared{err: err}
+	}
+	req, err := buildRequest(opts, filePath, source)
+	return prepared{source: source, req: req, err: err}
+}
+
+// requestHash identifies a request by everything the server would see, as the response cache does
+func requestHash(opts Options, req CompileRequest) string {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+	return cacheKey(compileURL(opts), jsonData)
+}
+
+// compile sends the file to Compiler Explorer and prints the result to w.
+// Use the response's ExitCode() for the process exit status.
+func compile(ctx context.Context, w io.Writer, opts Options, filePath string) (*compileResult, error) {
+	p := prepare(opts, filePath)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return compileRequest(ctx, w, opts, filePath, p.source, p.req)
+}
+
+// machineOutput reports whether the output is for scripts (-json or
+// -template), which leaves out progress notes and the source
+func machineOutput(opts Options) bool {
+	return opts.JSON || opts.Template != nil
+}
+
+// compileRequest is compile for a request already built from source
+func compileRequest(ctx context.Context, w io.Writer, opts Options, filePath string, source []byte, req CompileRequest) (*compileResult, error) {
+	// Show highlighted source if requested
+	if opts.ShowSource && !machineOutput(opts) && !opts.Quiet {
+		lang := getLangFromFile(sourceName(opts, filePath), opts.Lang)
+		fmt.Fprintln(w, colorize("36", "━━━ Source ━━━"))
+		fmt.Fprintln(w, highlight(string(source), lang, opts.Style, opts.Formatter))
+	}
+
+	if opts.DryRun {
+		return &compileResult{CompileResponse: &CompileResponse{}}, printDryRun(w, opts, filePath, req)
+	}
+	if (len(req.Files) > 0 && !opts.Quiet && !machineOutput(opts)) || opts.Verbose {
+		fmt.Fprintln(opts.Stderr, colorize("2", fmt.Sprintf("Uploading 1 main + %d project files (%s)", len(req.Files), formatBytes(requestSize(req)))))
+	}
+
+	// A spinner on stderr while the server works, gone before anything is
+	// printed. Notes from the request itself go through it to stop it first.
+	fetchOpts := opts
+	stopSpinner := func() {}
+	if !opts.Quiet && !machineOutput(opts) && !opts.noSpinner {
+		spin := startSpinner(opts.Stderr, fmt.Sprintf("Compiling with %s…", opts.Compiler))
+		stopSpinner = spin.Stop
+		fetchOpts.Stderr = spin
+		fetchOpts.API = reportingTo(opts.API, spin, opts.Verbose)
+	}
+	start := time.Now()
+	result, cached, err := fetch(ctx, fetchOpts, filePath, req)
+	stopSpinner()
+	if err != nil {
+		return nil, err
+	}
+	res := &compileResult{CompileResponse: result, cached: cached, roundTrip: time.Since(start)}
+
+	// Save the plain assembly text if requested
+	if opts.OutputFile != "" {
+		if err := os.WriteFile(opts.OutputFile, []byte(plainAsm(result.Asm)), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write assembly: %w", err)
+		}
+	}
+
+	// Record a successful compile as the baseline for later -since runs
+	if opts.SaveBaseline && result.Code == 0 {
+		if err := saveBaseline(opts, filePath, result.Asm); err != nil {
+			return nil, err
+		}
+	}
+
+	// Copy the plain assembly of a successful compile if requested
+	if opts.Copy && result.Code == 0 {
+		if err := copyToClipboard(plainAsm(result.Asm)); err != nil {
+			fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("Warning: could not copy the assembly: %v", err)))
+		} else if !opts.Quiet && !machineOutput(opts) {
+			fmt.Fprintln(opts.Stderr, colorize("2", fmt.Sprintf("Copied %d lines of assembly to the clipboard", len(result.Asm))))
+		}
+	}
+
+	// Machine-readable output: JSON on stdout, diagnostics on stderr
+	if opts.JSON {
+		for _, line := range result.Stderr {
+			fmt.Fprintln(opts.Stderr, line.Text)
+		}
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal response: %w", err)
+		}
+		fmt.Fprintln(w, string(out))
+		return res, nil
+	}
+	if opts.Template != nil {
+		for _, line := range result.Stderr {
+			fmt.Fprintln(opts.Stderr, line.Text)
+		}
+		return res, printTemplate(w, opts, filePath, res)
+	}
+
+	// Quiet mode: a single line on success, only diagnostics on failure
+	if opts.Quiet && result.ExitCode() == 0 && len(result.Stderr) == 0 {
+		fmt.Fprintln(w, colorize("32", fmt.Sprintf("✓ ok (%s)", time.Since(start).Round(time.Millisecond))))
+		return res, nil
+	}
+
+	// Print stderr if any
+	printDiagnostics(w, result.Stderr, req, sourceName(opts, filePath), opts.Context)
+
+	// Print stdout if any, labeled in execute mode so it isn't mistaken for the program's
+	if !opts.Quiet {
+		if result.ExecResult != nil && len(result.Stdout) > 0 {
+			fmt.Fprintln(w, "\n"+colorize("36", "━━━ Compiler Output ━━━"))
+		}
+		for _, line := range result.Stdout {
+			fmt.Fprintln(w, line.Text)
+		}
+	}
+
+	// Print the selected non-assembly view in place of the assembly
+	isAsmView := opts.View == "" || opts.View == defaultView
+	if !isAsmView && !opts.Quiet {
+		printView(w, opts.View, views[opts.View], result, getLangFromFile(sourceName(opts, filePath), opts.Lang), opts)
+	}
+
+	// Print assembly with syntax highlighting (hidden in execute mode unless -source is given)
+	if isAsmView && len(result.Asm) > 0 && !opts.Quiet && (!opts.Filters.Execute || opts.ShowSource) {
+		switch {
+		case opts.WatchDiff && opts.previousAsm != nil:
+			fmt.Fprintln(w, "\n"+colorize("36", "━━━ Assembly Diff ━━━"))
+			printDiff(w, diffAsm(opts.previousAsm, result.Asm), "previous", "current")
+		case opts.Fold:
+			fmt.Fprintln(w, "\n"+colorize("36", "━━━ Assembly ━━━"))
+			printFolded(result.Asm, opts, newAsmPrinter(w, opts, result.Asm))
+		case opts.Split:
+			fmt.Fprintln(w, "\n"+colorize("36", "━━━ Assembly ━━━"))
+			printSplit(result.Asm, string(source), getLangFromFile(sourceName(opts, filePath), opts.Lang), opts, newAsmPrinter(w, opts, result.Asm))
+		case opts.Interleave:
+			fmt.Fprintln(w, "\n"+colorize("36", "━━━ Assembly ━━━"))
+			printInterleaved(result.Asm, strings.Split(string(source), "\n"), newAsmPrinter(w, opts, result.Asm))
+		default:
+			fmt.Fprintln(w, "\n"+colorize("36", "━━━ Assembly ━━━"))
+			newAsmPrinter(w, opts, result.Asm).print(result.Asm)
+		}
+		if opts.HighlightLine > 0 && !mapsToLine(result.Asm, opts.HighlightLine) {
+			fmt.Fprintln(w, colorize("2", fmt.Sprintf("(no assembly maps to source line %d)", opts.HighlightLine)))
+		}
+		if opts.Stats {
+			printStats(w, result.Asm)
+		}
+	}
+
+	// Print the LLVM IR (absent when the compiler has no IR output)
+	if opts.IR && !opts.Quiet {
+		if result.IrOutput != nil && len(result.IrOutput.Asm) > 0 {
+			fmt.Fprintln(w, "\n"+colorize("36", "━━━ LLVM IR ━━━"))
+			fmt.Fprint(w, highlight(plainAsm(result.IrOutput.Asm), "llvm", opts.Style, opts.Formatter))
+		} else if result.Code == 0 {
+			fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("Warning: compiler %s returned no LLVM IR (only clang- and LLVM-based compilers support -ir)", opts.Compiler)))
+		}
+	}
+
+	// Print tool reports such as llvm-mca's
+	if !opts.Quiet {
+		for _, tool := range result.Tools {
+			printTool(w, opts.Stderr, tool)
+		}
+		if opts.MCA && len(result.Tools) == 0 && result.Code == 0 {
+			fmt.Fprintln(opts.Stderr, colorize("33", "Warning: the server returned no llvm-mca output"))
+		}
+	}
+
+	// Print optimization remarks (present only when requested)
+	if opts.OptRemarks && !opts.Quiet {
+		printRemarks(w, result.OptOutput, strings.Split(string(source), "\n"), req.Files)
+	}
+
+	// Print the program's runtime output
+	if run := result.ExecResult; run != nil {
+		fmt.Fprintln(w, "\n"+colorize("36", "━━━ Program Output ━━━"))
+		for _, line := range run.StdOut {
+			fmt.Fprintln(w, line.Text)
+		}
+		for _, line := range run.StdErr {
+			fmt.Fprintln(w, colorize("31", line.Text))
+		}
+
+		color := "32"
+		if run.Code != 0 {
+			color = "31"
+		}
+		fmt.Fprintln(w, colorize(color, fmt.Sprintf("Program exited with code %d", run.Code)))
+	}
+
+	if opts.Link {
+		link, err := createShortLink(ctx, opts, string(source), sourceName(opts, filePath))
+		if err != nil {
+			fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("Warning: could not create permalink: %v", err)))
+		} else {
+			fmt.Fprintln(w, "\n"+colorize("36", "━━━ Permalink ━━━"))
+			fmt.Fprintln(w, link)
+			if opts.Open {
+				openBrowser(opts.Stderr, link)
+			}
+		}
+	}
+
+	if opts.Timing {
+		fmt.Fprintln(w, "\n"+colorize("2", timingLine(res)))
+	}
+
+	if result.Code != 0 {
+		printFailedSteps(w, result.BuildSteps)
+		fmt.Fprintln(w, "\n"+colorize("31", fmt.Sprintf("✗ Compilation failed (exit code %d)", result.Code)))
+	}
+
+	return res, nil
+}
+
+// compileResult is a response with how long it took to get, for the timing
+// and watch status lines
+type compileResult struct {
+	*CompileResponse
+	cached    bool // served from the local response cache
+	roundTrip time.Duration
+}
+
+// status summarizes the result in a few words: ✓ or ✗, the instruction count and the round trip
+func (r *compileResult) status() string {
+	mark := colorize("32", "✓")
+	if r.Code != 0 {
+		mark = colorize("31", "✗")
+	}
+	total, _ := asmStats(r.Asm)
+	trip := r.roundTrip.Round(time.Millisecond).String()
+	if r.cached {
+		trip = "cached"
+	}
+	return fmt.Sprintf("%s %d insns %s", mark, total, trip)
+}
+
+// timingLine summarizes where the time went: compiling on the server, running the
+// program, and the full round trip as seen by the client
+func timingLine(r *compileResult) string {
+	var parts []string
+	if r.ExecTime != "" {
+		parts = append(parts, fmt.Sprintf("compile %sms", r.ExecTime))
+	}
+	if r.TimedOut {
+		parts = append(parts, "timed out")
+	}
+	if run := r.ExecResult; run != nil && run.ExecTime != "" {
+		parts = append(parts, fmt.Sprintf("run %sms", run.ExecTime))
+	}
+	if r.cached {
+		parts = append(parts, "round trip skipped (local cache)")
+	} else {
+		parts = append(parts, fmt.Sprintf("round trip %s", r.roundTrip.Round(time.Millisecond)))
+	}
+	return "⏱ " + strings.Join(parts, " · ")
+}
+
+// requestSize is the total size of the source and project files in a request
+func requestSize(req CompileRequest) int64 {
+	total := int64(len(req.Source))
+	for _, f := range req.Files {
+		total += int64(len(f.Contents))
+	}
+	return total
+}
+
+// printDryRun shows what a compile would upload: the endpoint, every file with
+// its size, and the request options
+func printDryRun(w io.Writer, opts Options, filePath string, req CompileRequest) error {
+	fmt.Fprintln(w, "\n"+colorize("36", "━━━ Dry Run ━━━"))
+	fmt.Fprintln(w, "POST "+compileURL(opts))
+
+	name := filePath
+	if opts.CMake {
+		name = cmakeListsName
+	}
+	width := len(name)
+	for _, f := range req.Files {
+		width = max(width, len(f.Filename))
+	}
+	fmt.Fprintln(w, "\nFiles:")
+	fmt.Fprintf(w, "  %-*s  %8s  %s\n", width, name, formatBytes(int64(len(req.Source))), colorize("2", "(source)"))
+	for _, f := range req.Files {
+		fmt.Fprintf(w, "  %-*s  %8s\n", width, f.Filename, formatBytes(int64(len(f.Contents))))
+	}
+	fmt.Fprintln(w, colorize("2", fmt.Sprintf("  %d files, %s", len(req.Files)+1, formatBytes(requestSize(req)))))
+
+	options, err := json.MarshalIndent(req.Options, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	fmt.Fprintln(w, "\nOptions:")
+	fmt.Fprintln(w, "  "+string(options))
+	if req.BypassCache != ce.BypassNone {
+		fmt.Fprintln(w, colorize("2", fmt.Sprintf("\nbypassCache: %d (the server compiles afresh)", req.BypassCache)))
+	}
+	return nil
+}
+
+// plainAsm joins the assembly lines into uncolored text, one instruction per line
+func plainAsm(asm []AsmLine) string {
+	var b strings.Builder
+	for _, line := range asm {
+		b.WriteString(line.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// funcLabel returns the label name if the line is a top-level (function) label.
+// Local labels such as ".LBB0_1:" and indented lines are not function labels.
+func funcLabel(text string) (string, bool) {
+	if text == "" || text[0] == ' ' || text[0] == '\t' || text[0] == '.' {
+		return "", false
+	}
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasSuffix(trimmed, ":") {
+		return "", false
+	}
+	return strings.TrimSuffix(trimmed, ":"), true
+}
+
+// matchesFunc reports whether a label refers to the function name, accepting
+// plain ("square"), demangled ("ns::square(int)"), Itanium-mangled ("_Z6squarei")
+// and Zig-qualified ("main.square") spellings
+func matchesFunc(label, name string, foldCase bool) bool {
+	if foldCase {
+		label, name = strings.ToLower(label), strings.ToLower(name)
+	}
+	if label == name {
+		return true
+	}
+
+	// Demangled: strip the parameter list / template arguments
+	base := label
+	if i := strings.IndexAny(base, "(<"); i >= 0 {
+		base = base[:i]
+	}
+	if base == name || strings.HasSuffix(base, "::"+name) || strings.HasSuffix(base, "."+name) {
+		return true
+	}
+
+	// Itanium mangling encodes identifiers as <length><name>
+	mangled := strings.HasPrefix(label, "_Z") || (foldCase && strings.HasPrefix(label, "_z"))
+	return mangled && strings.Contains(label, fmt.Sprintf("%d%s", len(name), name))
+}
+
+// filterFunction keeps only the lines from each label matching name up to the
+// next function label (or end of output)
+func filterFunction(asm []AsmLine, name string, foldCase bool) []AsmLine {
+	var out []AsmLine
+	inside := false
+	for _, line := range asm {
+		if label, ok := funcLabel(line.Text); ok {
+			inside = matchesFunc(label, name, foldCase)
+		}
+		if inside {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// grepAsm keeps the lines matching re, with before and after lines of context
+// around each match. Separate groups are divided by a blank line.
+func grepAsm(asm []AsmLine, re *regexp.Regexp, before, after int) []AsmLine {
+	keep := make([]bool, len(asm))
+	for i, line := range asm {
+		if re.MatchString(line.Text) {
+			for j := max(i-before, 0); j <= min(i+after, len(asm)-1); j++ {
+				keep[j] = true
+			}
+		}
+	}
+	var out []AsmLine
+	for i, line := range asm {
+		if !keep[i] {
+			continue
+		}
+		if len(out) > 0 && !keep[i-1] {
+			out = append(out, AsmLine{})
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// tidyAsm trims trailing whitespace and collapses runs of blank lines into one
+func tidyAsm(asm []AsmLine) []AsmLine {
+	out := make([]AsmLine, 0, len(asm))
+	for _, line := range asm {
+		line.Text = strings.TrimRight(line.Text, " \t")
+		if line.Text == "" && len(out) > 0 && out[len(out)-1].Text == "" {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// printInterleaved prints assembly with the originating source line shown above
+// each run of instructions that maps to a new line of the main file
+func printInterleaved(asm []AsmLine, sourceLines []string, p *asmPrinter) {
+	var block []AsmLine
+	flush := func() {
+		p.print(block)
+		block = nil
+	}
+
+	lastLine := 0
+	for _, line := range asm {
+		// Only lines from the main file (File == nil) can be looked up
+		if src := line.Source; src != nil && src.File == nil && src.Line != lastLine {
+			lastLine = src.Line
+			if src.Line >= 1 && src.Line <= len(sourceLines) {
+				flush()
+				fmt.Fprintln(p.w, colorize("2", fmt.Sprintf("%4d │ %s", src.Line, sourceLines[src.Line-1])))
+			}
+		}
+		block = append(block, line)
+	}
+	flush()
+}
+
+// addWatchTree adds dir and all of its subdirectories (except skipped ones) to the watcher
+func addWatchTree(watcher *fsnotify.Watcher, dir string, skipDirs map[string]bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && skipDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// writesFile reports whether a watcher event may have changed a file's contents
+func writesFile(event fsnotify.Event) bool {
+	return event.Has(fsnotify.Write) || event.Has(fsnotify.Create)
+}
+
+// shouldRecompile reports whether a watcher event touches a project source file:
+// a write or create of a project file (see projectFileFilter) outside any skipped directory
+func shouldRecompile(event fsnotify.Event, include func(rel string) bool, root string, skipDirs map[string]bool) bool {
+	if !writesFile(event) {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, event.Name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		// Outside the project tree (e.g. the main file's directory above -root)
+		return include(filepath.Base(event.Name))
+	}
+	rel = filepath.ToSlash(rel)
+	if !include(rel) {
+		return false
+	}
+	for _, part := range strings.Split(path.Dir(rel), "/") {
+		if skipDirs[part] {
+			return false
+		}
+	}
+	return true
+}
+
+// watchTarget is one file given on the command line, with its project tree
+type watchTarget struct {
+	path      string // as given by the user
+	absPath   string
+	include   func(rel string) bool // project files, see projectFileFilter
+	searchDir string
+}
+
+// rateLimitBackoff is how long a rate-limited watch waits before compiling
+// again when the server sends no Retry-After
+const rateLimitBackoff = 10 * time.Second
+
+// watch recompiles on every change until ctx is cancelled (Ctrl-C / SIGTERM),
+// printing to w. With several files, only the file whose project changed is recompiled.
+func watch(ctx context.Context, w io.Writer, opts Options, filePaths []string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	skipDirs := skipDirSet(opts.SkipDirs)
+	var targets []watchTarget
+	for _, filePath := range filePaths {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
+
+		// Watch the whole project tree so edits to imported files are noticed
+		dir := filepath.Dir(absPath)
+		searchDir, err := projectSearchDir(opts, absPath)
+		if err != nil {
+			return err
+		}
+		if !opts.NoMultifile {
+			if err := addWatchTree(watcher, searchDir, skipDirs); err != nil {
+				return fmt.Errorf("failed to watch directory: %w", err)
+			}
+		}
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch directory: %w", err)
+		}
+		targets = append(targets, watchTarget{filePath, absPath, projectFileFilter(opts, absPath, searchDir), searchDir})
+	}
+
+	// -file uploads can live outside every project tree, so watch them too
+	extraPaths := make(map[string]bool)
+	for _, f := range opts.ExtraFiles {
+		absPath, err := filepath.Abs(f.path)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+			return fmt.Errorf("failed to watch directory: %w", err)
+		}
+		extraPaths[absPath] = true
+	}
+
+	fmt.Fprintln(w, colorize("34", fmt.Sprintf("⚡ Watching %s", strings.Join(filePaths, ", "))))
+	fmt.Fprintln(w, colorize("34", fmt.Sprintf("   Compiler: %s", opts.Compiler)))
+	fmt.Fprintln(w, colorize("34", fmt.Sprintf("   Args: %s", opts.Args)))
+	fmt.Fprintln(w, colorize("34", fmt.Sprintf("   Server: %s", opts.Server))+"\n")
+
+	// Last assembly per target, the baseline for -watch-diff
+	previous := make([][]AsmLine, len(targets))
+
+	// Last request per target; with caching, a save that changes nothing the
+	// server would see skips the recompile
+	lastHash := make([]string, len(targets))
+
+	// A rate-limited compile holds off the next one until the server allows it
+	var rateLimitedUntil time.Time
+
+	// run compiles a prepared target to out and records its baseline for the next change
+	run := func(out io.Writer, i int, iterOpts Options, p prepared) *compileResult {
+		var result *compileResult
+		err := p.err
+		if err == nil {
+			result, err = compileRequest(ctx, out, iterOpts, targets[i].path, p.source, p.req)
+		}
+		if err == nil {
+			lastHash[i] = requestHash(opts, p.req)
+		} else {
+			// Failed requests are retried on the next save, even an unchanged one
+			lastHash[i] = ""
+		}
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintln(out, colorize("31", fmt.Sprintf("Error: %v", err)))
+		}
+		var statusErr *ce.StatusError
+		if errors.As(err, &statusErr) && statusErr.RateLimited() {
+			wait := statusErr.RetryAfter
+			if wait == 0 {
+				wait = rateLimitBackoff
+			}
+			rateLimitedUntil = time.Now().Add(wait)
+			fmt.Fprintln(out, colorize("33", fmt.Sprintf("Changes saved before %s will compile then", rateLimitedUntil.Format("15:04:05"))))
+		}
+		if result != nil {
+			previous[i] = result.Asm
+		}
+		return result
+	}
+
+	// hook runs -on-success or -on-failure once a target's output is printed
+	hook := func(i int, result *compileResult) {
+		if ctx.Err() != nil || opts.DryRun {
+			return
+		}
+		if result != nil && result.ExitCode() == 0 {
+			if opts.OnSuccess != "" {
+				runHook(w, opts.Stderr, "on-success", opts.OnSuccess, targets[i].path, result)
+			}
+		} else if opts.OnFailure != "" {
+			runHook(w, opts.Stderr, "on-failure", opts.OnFailure, targets[i].path, result)
+		}
+	}
+
+	// failed records whether the output on screen includes a failure, which
+	// -keep-errors leaves up
+	failed := false
+
+	// Initial compile
+	for i, t := range targets {
+		if len(targets) > 1 {
+			printFileHeader(w, t.path, i > 0)
+		}
+		result := run(w, i, opts, prepare(opts, t.path))
+		failed = failed || result == nil || result.ExitCode() != 0
+		hook(i, result)
+	}
+
+	// pending marks targets touched since the last recompile
+	pending := make([]bool, len(targets))
+	recompile := func() {
+		// Rebuild the requests first so unchanged saves leave the screen alone
+		builds := make([]*prepared, len(targets))
+		changed := false
+		for i, t := range targets {
+			if !pending[i] {
+				continue
+			}
+			pending[i] = false
+			p := prepare(opts, t.path)
+			if p.err == nil && !opts.NoCache && requestHash(opts, p.req) == lastHash[i] {
+				fmt.Fprintln(w, colorize("2", fmt.Sprintf("⚡ %s — %s no change", t.path, time.Now().Format("15:04:05"))))
+				continue
+			}
+			builds[i], changed = &p, true
+		}
+		if !changed {
+			return
+		}
+
+		// Keep earlier output in scrollback with -no-clear, marking where this
+		// run starts. With -keep-errors a failure stays up while the builds
+		// keep failing, so that choice waits for the first result.
+		startRun := func(keep bool) {
+			if keep {
+				fmt.Fprintln(w, "\n"+colorize("2", separator(time.Now())))
+			} else {
+				clearScreen(w)
+			}
+		}
+		deferred := opts.KeepErrors && failed && !opts.NoClear
+		if !deferred {
+			startRun(opts.NoClear)
+		}
+		failed = false
+		first := true
+		for i, t := range targets {
+			if builds[i] == nil {
+				continue
+			}
+
+			// The header carries the outcome, so it is printed once the output is in
+			started := time.Now()
+			iterOpts := opts
+			iterOpts.previousAsm = previous[i]
+			var out bytes.Buffer
+			header := colorize("34", fmt.Sprintf("⚡ %s — %s", t.path, started.Format("15:04:05")))
+			result := run(&out, i, iterOpts, *builds[i])
+			ok := result != nil && result.ExitCode() == 0
+			if deferred {
+				startRun(!ok)
+				deferred = false
+			}
+			if !first {
+				fmt.Fprintln(w)
+			}
+			first = false
+			if result != nil && !opts.DryRun {
+				header += " " + result.status()
+			}
+			fmt.Fprintln(w, header+"\n")
+			out.WriteTo(w)
+			failed = failed || !ok
+			hook(i, result)
+		}
+	}
+
+	// Debounce timer; compiles run on this goroutine so they never overlap
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Reset any color left by interrupted output; the deferred Close stops the watcher
+			if colorEnabled {
+				fmt.Fprint(w, "\033[0m")
+			}
+			fmt.Fprintln(w, "\n"+colorize("34", "⚡ Stopped watching"))
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// Start watching directories created after startup
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if !skipDirs[info.Name()] {
+						if err := addWatchTree(watcher, event.Name, skipDirs); err != nil {
+							fmt.Fprintln(w, colorize("31", fmt.Sprintf("Watcher error: %v", err)))
+						}
+					}
+					continue
+				}
+			}
+
+			// A changed command-line file recompiles just that file, whatever
+			// -include and -exclude say; any other project file recompiles
+			// every target whose project contains it
+			changed := false
+			for i, t := range targets {
+				if event.Name == t.absPath && writesFile(event) {
+					pending[i], changed = true, true
+				}
+			}
+			if !changed {
+				extra := extraPaths[event.Name] && writesFile(event)
+				for i, t := range targets {
+					project := !opts.NoMultifile && shouldRecompile(event, t.include, t.searchDir, skipDirs)
+					if (extra || project) && !isTarget(targets, event.Name) {
+						pending[i], changed = true, true
+					}
+				}
+			}
+
+			// A single debounce timer coalesces bursts across all project files
+			if changed {
+				if wait := time.Until(rateLimitedUntil); wait > 0 {
+					debounce.Reset(max(wait, opts.Debounce))
+				} else if opts.Debounce <= 0 {
+					recompile()
+				} else {
+					debounce.Reset(opts.Debounce)
+				}
+			}
+		case <-debounce.C:
+			recompile()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintln(w, colorize("31", fmt.Sprintf("Watcher error: %v", err)))
+		}
+	}
+}
+
+func isTarget(targets []watchTarget, absPath string) bool {
+	for _, t := range targets {
+		if t.absPath == absPath {
+			return true
+		}
+	}
+	return false
+}
+
+// printFileHeader separates the output of several files compiled in one run
+func printFileHeader(w io.Writer, filePath string, spaced bool) {
+	if spaced {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, colorize("1;35", fmt.Sprintf("━━━━━━ %s ━━━━━━", filePath)))
+}
+
+func main() {
+	stdout, stderr := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	var (
+		server         = flag.String("server", "https://godbolt.org", "Compiler Explorer server URL")
+		compiler       = flag.String("compiler", "ztrunk", "Compiler ID (e.g., ztrunk, z0140, g141, clang1910), or a name to look up in the server's compiler list (e.g., clang19, \"gcc 13\")")
+		initConfig     = flag.Bool("init", false, "Write a commented config file listing every setting, then exit")
+		force          = flag.Bool("force", false, "With -init, overwrite existing files")
+		sample         = flag.String("sample", "", "With -init, also write a sample source to the current directory (zig or cpp)")
+		profile        = flag.String("profile", "", "Apply a [profile.<name>] section from the config files")
+		args           = flag.String("args", "", "Compiler arguments (e.g., '-O ReleaseFast -target aarch64-macos')")
+		once           = flag.Bool("once", false, "Compile once and exit (don't watch)")
+		tui            = flag.Bool("tui", false, "Browse the source and assembly in two scrolling panes, recompiling on changes")
+		count          = flag.Int("count", 1, "With -once, compile N times uncached and report the min/mean/max/p95 round trip")
+		watchDiff      = flag.Bool("watch-diff", false, "In watch mode, show a diff against the previous assembly instead of the full output")
+		onSuccess      = flag.String("on-success", "", "Shell command to run after each successful watch compile (sees CET_HOOK_CODE, CET_HOOK_FILE, CET_HOOK_INSN_COUNT)")
+		onFailure      = flag.String("on-failure", "", "Shell command to run after each failed watch compile")
+		noClear        = flag.Bool("no-clear", false, "Don't clear the screen between watch iterations")
+		keepErrors     = flag.Bool("keep-errors", false, "In watch mode, keep failed compiles on screen until a build succeeds")
+		debounce       = flag.Duration("debounce", 100*time.Millisecond, "Delay after the last change before recompiling in watch mode (0 = immediately)")
+		showSource     = flag.Bool("source", false, "Show highlighted source code")
+		showContext    = flag.Bool("context", false, "Print the source line and column each error or warning refers to")
+		projectRoot    = flag.String("root", "", "Project root for multi-file imports (default: file's directory)")
+		includes       = flag.String("include", "", "Comma-separated globs of project files to upload, relative to the root (e.g. 'src/**/*.zig')")
+		excludes       = flag.String("exclude", "", "Comma-separated globs of project files to leave out (e.g. '**/test_*.zig')")
+		skip           = flag.String("skip", "", "Comma-separated directory names to skip, in addition to "+strings.Join(defaultSkipDirs, ","))
+		followSymlinks = flag.Bool("follow-symlinks", false, "Follow symlinked directories when collecting project files")
+		noMultifile    = flag.Bool("no-multifile", false, "Upload only the main source, without collecting project files")
+		maxSize        = flag.Int64("max-size", 4<<20, "Maximum total size in bytes of collected project files (0 = unlimited)")
+		maxFileSize    = flag.Int64("max-file-size", 1<<20, "Maximum size in bytes of a single collected project file; larger ones are skipped (0 = unlimited)")
+		maxSource      = flag.Int64("max-source", 1<<20, "Maximum size in bytes of the main source file (0 = unlimited)")
+		lang           = flag.String("lang", "", "Override the detected source language (e.g., zig, c, cpp, cuda); use with stdin input")
+		filename       = flag.String("filename", "", "Logical name of the main source, sent with the request and used for language detection, diagnostics and permalinks (default: the file's base name)")
+		strict         = flag.Bool("strict", false, "Fail instead of warning when the compiler does not match the file's language")
+		jsonOutput     = flag.Bool("json", false, "Print the compile response as JSON instead of formatted output")
+		templateText   = flag.String("template", "", "Print each compile result through this Go text/template instead of formatted output, e.g. '{{.Code}} {{.Instructions}}'")
+		quiet          = flag.Bool("quiet", false, "Only print diagnostics on failure and a one-line status on success")
+		link           = flag.Bool("link", false, "Print a shareable Compiler Explorer permalink")
+		openLink       = flag.Bool("open", false, "Open the permalink in the default browser (implies -link)")
+		compilerList   = flag.String("compilers", "", "Comma-separated compiler IDs to compile the file with concurrently, each under its own header (with -once)")
+		targetList     = flag.String("targets", "", "Comma-separated target triples to compile the file for concurrently, each under its own header (with -once)")
+		diffCompiler   = flag.String("diff-compiler", "", "Diff the assembly against this compiler ID (with -once)")
+		diffArgs       = flag.String("diff-args", "", "Diff the assembly against a compile with these arguments instead (with -once)")
+		outputFile     = flag.String("o", "", "Also write the plain assembly to this file")
+		copyAsm        = flag.Bool("copy", false, "Copy the plain assembly to the clipboard after a successful compile")
+		saveBaseline   = flag.Bool("save-baseline", false, "With -once, save the assembly of a successful compile as the baseline for -since")
+		since          = flag.Bool("since", false, "With -once, diff the assembly against the saved baseline, exiting 1 if it changed")
+		baselineFile   = flag.String("baseline", "", "Baseline file for -save-baseline and -since (default: <file>"+baselineSuffix+")")
+		interleave     = flag.Bool("interleave", false, "Show each source line above the assembly it generates")
+		split          = flag.Bool("split", false, "Show the source beside the assembly it generates (stacked like -interleave on terminals under 100 columns)")
+		asmLineNo      = flag.Bool("asm-lineno", false, "Number the printed assembly lines")
+		fold           = flag.Bool("fold", false, "Collapse each function to its label and instruction count (-func expands one)")
+		tidy           = flag.Bool("tidy", false, "Trim trailing whitespace and collapse blank lines in the printed assembly")
+		cmake          = flag.Bool("cmake", false, "Build the CMake project containing the file (CMakeLists.txt at -root or the nearest parent)")
+		cmakeArgs      = flag.String("cmake-args", "", "Arguments for the CMake configure step (with -cmake), e.g. -DCMAKE_BUILD_TYPE=Release")
+		zigBuild       = flag.Bool("zig-build", true, "For Zig sources, use the nearest directory with a build.zig as the project root and upload build.zig and build.zig.zon too")
+		timing         = flag.Bool("timing", false, "Print server compile time and client round-trip time")
+		highlightLine  = flag.Int("highlight-line", 0, "Mark the assembly generated from this source line")
+		linesFlag      = flag.String("lines", "", "Compile only lines START:END of the file (inclusive)")
+		stats          = flag.Bool("stats", false, "Print instruction counts in total and per function")
+		viewName       = flag.String("view", defaultView, "Output to show: asm, ast or preprocessed")
+		mca            = flag.Bool("mca", false, "Run llvm-mca on the assembly and show its throughput report")
+		ir             = flag.Bool("ir", false, "Also show the LLVM IR (clang and other LLVM-based compilers)")
+		optRemarks     = flag.Bool("opt-remarks", false, "Show optimization remarks (inlining, vectorization) by source line")
+		funcName       = flag.String("func", "", "Only show the assembly for this function")
+		ifuncName      = flag.String("ifunc", "", "Like -func, but matches the name case-insensitively")
+		grepPattern    = flag.String("grep", "", "Only show assembly lines matching this regular expression")
+		grepAfter      = flag.Int("A", 0, "With -grep, also show this many lines after each match")
+		grepBefore     = flag.Int("B", 0, "With -grep, also show this many lines before each match")
+
+		// Assembly filters and execution
+		filters   = filterFlags(flag.CommandLine)
+		execute   = flag.Bool("execute", false, "Run the compiled program and show its output")
+		stdinFile = flag.String("stdin", "", "File to feed the executed program as stdin ('-' for cet's own stdin)")
+		progArgs  = flag.String("prog-args", "", "Arguments passed to the executed program, split like a shell does (quote an argument to keep its spaces)")
+
+		timeout = flag.Duration("timeout", 30*time.Second, "HTTP request timeout")
+		retries = flag.Int("retries", 2, "Retries for network errors and 5xx responses")
+		noGzip  = flag.Bool("no-gzip", false, "Send large requests uncompressed (by default bodies of 32 KiB or more are gzipped)")
+		verbose = flag.Bool("verbose", false, "Log HTTP requests and responses to stderr")
+		proxy   = flag.String("proxy", "", "Proxy URL (http://, https:// or socks5://); defaults to HTTP(S)_PROXY")
+		token   = flag.String("token", "", "Bearer token for servers behind an auth proxy (falls back to $CET_TOKEN)")
+
+		noCache       = flag.Bool("no-cache", false, "Always contact the server instead of using cached responses")
+		serverNoCache = flag.Bool("server-nocache", false, "Ask the server to compile afresh instead of reusing its own cached result (implies -no-cache)")
+		offline       = flag.Bool("offline", false, "Never contact the server; show the newest cached response for the file")
+		dryRun        = flag.Bool("dry-run", false, "Print the files and options that would be sent, without contacting the server")
+		cacheTTL      = flag.Duration("cache-ttl", 24*time.Hour, "How long cached responses stay valid (0 = forever)")
+
+		colorDepth = flag.String("color-depth", "auto", "Highlighting color depth: auto (24-bit if $COLORTERM says so), 256, 16m or 8")
+		colorMode  = flag.String("color", "auto", "Colored output: auto (only on a terminal), always or never")
+		noColor    = flag.Bool("no-color", false, "Disable colored output, same as -color=never (also honors NO_COLOR)")
+		theme      = flag.String("theme", "gruvbox", "Syntax highlighting theme (see -list-themes)")
+		styleFile  = flag.String("style-file", "", "Load the highlighting style from a chroma XML style file instead of -theme")
+		listThemes = flag.Bool("list-themes", false, "List available highlighting themes and exit")
+
+		listComp  = flag.Bool("list-compilers", false, "List available compilers (optionally for the language given as argument) and exit")
+		listLangs = flag.Bool("list-languages", false, "List languages supported by the server and exit")
+		listLibs  = flag.Bool("list-libs", false, "List libraries for the language given as argument and exit")
+
+		completion = flag.String("completion", "", "Print the bash, zsh or fish completion script and exit")
+	)
+	var headerPairs, libSpecs, overrideSpecs, fileSpecs, optSpecs multiFlag
+	flag.Var(&headerPairs, "header", "Extra HTTP header as key=value (repeatable)")
+	flag.Var(&libSpecs, "lib", "Library as id:version, e.g. fmt:trunk (repeatable, see -list-libs)")
+	flag.Var(&overrideSpecs, "override", "Compiler override as key=value, e.g. stdlib=libc++ or arch=aarch64 (repeatable)")
+	flag.Var(&optSpecs, "opt", "Request option as path=value below \"options\", e.g. compilerOptions.skipAsm=true; values are JSON or else strings (repeatable)")
+	flag.Var(&fileSpecs, "file", "Extra file to upload as path=name, e.g. ../shared/util.zig=util.zig (repeatable, replaces a collected file of that name)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(stderr, "cet - Compiler Explorer Terminal\n\n")
+		fmt.Fprintf(stderr, "Usage: cet [options] <file> [file...]\n")
+		fmt.Fprintf(stderr, "       cet -list-compilers [language]\n")
+		fmt.Fprintf(stderr, "       cet -list-languages\n")
+		fmt.Fprintf(stderr, "       cet -list-libs <language>\n")
+		fmt.Fprintf(stderr, "       cet -list-themes\n\n")
+		fmt.Fprintf(stderr, "Options:\n")
+		printDefaults(stderr)
+		fmt.Fprintf(stderr, "\nExamples:\n")
+		fmt.Fprintf(stderr, "  cet -args='-O ReleaseFast -target aarch64-macos -mcpu=apple_m4' main.zig\n")
+		fmt.Fprintf(stderr, "  cet -compiler=g132 -args='-O3' main.c\n")
+		fmt.Fprintf(stderr, "  cet -once -source main.zig\n")
+		fmt.Fprintf(stderr, "  cet -once a.c b.c c.c   # Compile several files in turn\n")
+		fmt.Fprintf(stderr, "  cet -once -execute main.c   # Run the program and show its output\n")
+		fmt.Fprintf(stderr, "  cet -once -execute -stdin=input.txt -prog-args='-n 10' main.c\n")
+		fmt.Fprintf(stderr, "  cet -intel=false -directives=false main.c   # AT&T syntax, keep directives\n")
+		fmt.Fprintf(stderr, "  cet -root=. src/main.zig   # Multi-file project with imports from repo root\n")
+		fmt.Fprintf(stderr, "  gen.sh | cet -once -lang=c -compiler=cg132 -   # Read source from stdin\n")
+		fmt.Fprintf(stderr, "  cet -list-compilers zig\n")
+		fmt.Fprintf(stderr, "  cet -compiler=g132 -lib=fmt:trunk main.cpp\n")
+		fmt.Fprintf(stderr, "\nDefaults can be set in ~/.config/cet/config.toml ($CET_CONFIG overrides the path)\n")
+		fmt.Fprintf(stderr, "with keys named after the flags, or with CET_* variables (e.g. CET_COMPILER=g132).\n")
+	}
+	// A config that fails to load is reported after parsing, so -init can replace it
+	userConfig, configErr := loadDefaults(flag.CommandLine)
+	flag.Parse()
+	if *completion != "" {
+		exitWithCompletion(stdout, stderr, *completion)
+	}
+	if *initConfig {
+		exitWithInit(stdout, stderr, *force, *sample)
+	}
+	if configErr != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", configErr)
+		os.Exit(1)
+	}
+
+	// The project config is found from the first input's directory (or the working directory)
+	projectDir := "."
+	if flag.NArg() > 0 && flag.Arg(0) != stdinPath {
+		projectDir = filepath.Dir(flag.Arg(0))
+	}
+	if abs, err := filepath.Abs(projectDir); err == nil {
+		projectDir = abs
+	}
+	projectConfig, err := applyProjectConfig(flag.CommandLine, stderr, projectDir)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *profile != "" {
+		if err := applyProfile(flag.CommandLine, *profile, projectConfig, userConfig); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	colorEnabled, err = useColor(*colorMode, *noColor)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	formatter, err := terminalFormatter(*colorDepth)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *listThemes {
+		for _, name := range styles.Names() {
+			fmt.Fprintln(stdout, name)
+		}
+		return
+	}
+
+	if _, ok := styles.Registry[*theme]; !ok {
+		fmt.Fprintf(stderr, "Warning: unknown theme %q, using %s\n", *theme, styles.Fallback.Name)
+	}
+	// styles.Get returns styles.Fallback for unknown names
+	style := styles.Get(*theme)
+	if *styleFile != "" {
+		if custom, err := loadStyle(*styleFile); err != nil {
+			fmt.Fprintln(stderr, colorize("33", fmt.Sprintf("Warning: %v; using the %s theme", err, style.Name)))
+		} else {
+			style = custom
+		}
+	}
+
+	headers, err := buildHeaders(headerPairs.values, *token)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := newHTTPClient(*timeout, *proxy)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	api := newAPIClient(stderr, *server, client, headers, *retries, *noGzip, *verbose)
+
+	if *listComp {
+		if err := listCompilers(stdout, api, flag.Arg(0)); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *listLangs {
+		if err := listLanguages(stdout, api); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *listLibs {
+		if flag.NArg() != 1 {
+			fmt.Fprintf(stderr, "Error: -list-libs needs a language ID (see -list-languages)\n")
+			os.Exit(1)
+		}
+		if err := listLibraries(stdout, api, flag.Arg(0)); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	includeGlobs, err := compileGlobs(splitList(*includes))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: -include: %v\n", err)
+		os.Exit(1)
+	}
+	excludeGlobs, err := compileGlobs(splitList(*excludes))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: -exclude: %v\n", err)
+		os.Exit(1)
+	}
+
+	var grepRe *regexp.Regexp
+	if *grepPattern != "" {
+		if grepRe, err = regexp.Compile(*grepPattern); err != nil {
+			fmt.Fprintf(stderr, "Error: -grep: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *grepAfter < 0 || *grepBefore < 0 {
+		fmt.Fprintf(stderr, "Error: -A and -B must not be negative\n")
+		os.Exit(1)
+	}
+	progArgList, err := splitArgs(*progArgs)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: -prog-args: %v\n", err)
+		os.Exit(1)
+	}
+
+	libraries, err := parseLibraries(libSpecs.values)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	overrides, err := parseOverrides(overrideSpecs.values)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	extraFiles, err := parseExtraFiles(fileSpecs.values)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	extraOptions, err := parseRequestOptions(optSpecs.values)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var tmpl *template.Template
+	if *templateText != "" {
+		if *jsonOutput {
+			fmt.Fprintf(stderr, "Error: -template and -json cannot be combined\n")
+			os.Exit(1)
+		}
+		if tmpl, err = parseTemplate(*templateText); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var lines lineRange
+	if *linesFlag != "" {
+		if lines, err = parseLineRange(*linesFlag); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	filePaths := flag.Args()
+
+	opts := Options{
+		Server:         *server,
+		Compiler:       *compiler,
+		Args:           *args,
+		Style:          style,
+		Formatter:      formatter,
+		Lang:           *lang,
+		Filename:       *filename,
+		Filters:        filters(),
+		ShowSource:     *showSource,
+		Context:        *showContext,
+		ProjectRoot:    *projectRoot,
+		SkipDirs:       splitList(*skip),
+		FollowSymlinks: *followSymlinks,
+		NoMultifile:    *noMultifile,
+		Include:        includeGlobs,
+		Exclude:        excludeGlobs,
+		MaxSize:        *maxSize,
+		MaxFileSize:    *maxFileSize,
+		MaxSource:      *maxSource,
+		Interleave:     *interleave,
+		Split:          *split,
+		Stats:          *stats,
+		AsmLineNo:      *asmLineNo,
+		Fold:           *fold,
+		Tidy:           *tidy,
+		CMake:          *cmake,
+		CMakeArgs:      *cmakeArgs,
+		ZigBuild:       *zigBuild,
+		Timing:         *timing,
+		HighlightLine:  *highlightLine,
+		Lines:          lines,
+		OptRemarks:     *optRemarks,
+		IR:             *ir,
+		View:           *viewName,
+		MCA:            *mca,
+		Libraries:      libraries,
+		Overrides:      overrides,
+		ExtraFiles:     extraFiles,
+		ExtraOptions:   extraOptions,
+		JSON:           *jsonOutput,
+		Template:       tmpl,
+		Quiet:          *quiet,
+		Link:           *link || *openLink,
+		Open:           *openLink,
+		OutputFile:     *outputFile,
+		Baseline:       *baselineFile,
+		SaveBaseline:   *saveBaseline,
+		Copy:           *copyAsm,
+		Debounce:       *debounce,
+		NoClear:        *noClear,
+		KeepErrors:     *keepErrors,
+		WatchDiff:      *watchDiff,
+		OnSuccess:      *onSuccess,
+		OnFailure:      *onFailure,
+		Verbose:        *verbose,
+		API:            api,
+		NoCache:        *noCache || *serverNoCache,
+		ServerNoCache:  *serverNoCache,
+		CacheTTL:       *cacheTTL,
+		Offline:        *offline,
+		DryRun:         *dryRun,
+		Func:           *funcName,
+		Grep:           grepRe,
+		GrepBefore:     *grepBefore,
+		GrepAfter:      *grepAfter,
+		ProgArgs:       progArgList,
+		Stderr:         stderr,
+	}
+	opts.Filters.Execute = *execute
+	if *ifuncName != "" {
+		opts.Func = *ifuncName
+		opts.FuncFoldCase = true
+	}
+	if opts.Offline && opts.Link {
+		fmt.Fprintln(stderr, colorize("33", "Warning: -link needs the server and is ignored with -offline"))
+		opts.Link, opts.Open = false, false
+	}
+	if opts.Offline && opts.ServerNoCache {
+		fmt.Fprintln(stderr, colorize("33", "Warning: -server-nocache needs the server and is ignored with -offline"))
+		opts.ServerNoCache = false
+	}
+	if _, ok := views[opts.View]; !ok {
+		fmt.Fprintf(stderr, "Error: unknown -view %q (valid: %s)\n", opts.View, viewNames())
+		os.Exit(1)
+	}
+
+	if *stdinFile != "" {
+		var input []byte
+		var err error
+		if *stdinFile == stdinPath {
+			input, err = io.ReadAll(os.Stdin)
+		} else {
+			input, err = os.ReadFile(*stdinFile)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: failed to read stdin input: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Stdin = string(input)
+	}
+
+	if *filename != "" && len(filePaths) > 1 {
+		fmt.Fprintf(stderr, "Error: -filename names a single input\n")
+		os.Exit(1)
+	}
+	if *noMultifile && *cmake {
+		fmt.Fprintf(stderr, "Error: -no-multifile cannot be combined with -cmake, which uploads project files\n")
+		os.Exit(1)
+	}
+	if *tui && (*once || len(filePaths) > 1 || filePaths[0] == stdinPath) {
+		fmt.Fprintf(stderr, "Error: -tui watches a single file and cannot be combined with -once or stdin\n")
+		os.Exit(1)
+	}
+
+	compilerIDs, targets := splitList(*compilerList), splitList(*targetList)
+	if len(compilerIDs) > 0 && len(targets) > 0 {
+		fmt.Fprintf(stderr, "Error: -compilers and -targets cannot be combined\n")
+		os.Exit(1)
+	}
+	if (len(compilerIDs) > 0 || len(targets) > 0) && (!*once || len(filePaths) > 1 || *diffCompiler != "" || *diffArgs != "" || *count > 1 || opts.OutputFile != "" || opts.Copy) {
+		fmt.Fprintf(stderr, "Error: -compilers and -targets require -once and a single input, and cannot be combined with -diff-compiler, -diff-args, -count, -o or -copy\n")
+		os.Exit(1)
+	}
+	if (*saveBaseline || *since) && (!*once || *saveBaseline && *since || *diffCompiler != "" || *diffArgs != "" || len(compilerIDs) > 0 || len(targets) > 0 || *count > 1) {
+		fmt.Fprintf(stderr, "Error: -save-baseline and -since require -once, exclude each other, and cannot be combined with -diff-compiler, -diff-args, -compilers, -targets or -count\n")
+		os.Exit(1)
+	}
+	if (*saveBaseline || *since) && *baselineFile == "" && slices.Contains(filePaths, stdinPath) {
+		fmt.Fprintf(stderr, "Error: source from stdin needs -baseline to name its baseline file\n")
+		os.Exit(1)
+	}
+	if *baselineFile != "" && len(filePaths) > 1 {
+		fmt.Fprintf(stderr, "Error: -baseline names the baseline of a single input\n")
+		os.Exit(1)
+	}
+	if *count < 1 || (*count > 1 && (!*once || len(filePaths) > 1 || *diffCompiler != "" || *diffArgs != "")) {
+		fmt.Fprintf(stderr, "Error: -count must be at least 1, and above 1 requires -once and a single input without -diff-compiler or -diff-args\n")
+		os.Exit(1)
+	}
+
+	for _, filePath := range filePaths {
+		if filePath == stdinPath {
+			if !*once || len(filePaths) > 1 {
+				fmt.Fprintf(stderr, "Error: reading source from stdin requires -once and a single input\n")
+				os.Exit(1)
+			}
+			if *stdinFile == stdinPath {
+				fmt.Fprintf(stderr, "Error: -stdin=- cannot be combined with source from stdin\n")
+				os.Exit(1)
+			}
+		} else if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			fmt.Fprintf(stderr, "Error: file %s does not exist\n", filePath)
+			os.Exit(1)
+		}
+	}
+
+	// The compiler list backs both the fuzzy -compiler lookup and the language
+	// check. A cached list is used for both; otherwise it is only fetched when
+	// a compiler needs looking up or -strict asks for the check, so exact IDs
+	// cost no request. Without it, compiler IDs are used as given and nothing
+	// is checked.
+	ids := []*string{&opts.Compiler, diffCompiler}
+	for i := range compilerIDs {
+		ids = append(ids, &compilerIDs[i])
+	}
+	var compilers []Compiler
+	if !opts.Offline && !opts.DryRun {
+		if !opts.NoCache {
+			if cached, ok := cachedCompilers(opts.API, opts.CacheTTL); ok {
+				compilers = cached
+			}
+		}
+		lookup := *strict || slices.ContainsFunc(ids, func(id *string) bool { return *id != "" && !looksLikeCompilerID(*id) })
+		if compilers == nil && lookup {
+			if compilers, err = fetchCompilers(opts.API, opts.NoCache, opts.CacheTTL); err != nil && opts.Verbose {
+				fmt.Fprintln(stderr, colorize("2", fmt.Sprintf("Skipping the compiler lookup and language check: %v", err)))
+			}
+		}
+	}
+
+	// Resolve fuzzy compiler names ("clang19", "gcc 13") to real IDs
+	if compilers != nil {
+		interactive := isTerminal(os.Stdin) && isTerminal(os.Stderr) && filePaths[0] != stdinPath && *stdinFile != stdinPath
+		langs := expectedLangs(sourceName(opts, filePaths[0]), opts.Lang)
+		for _, id := range ids {
+			if *id == "" {
+				continue
+			}
+			resolved, err := resolveCompiler(opts, compilers, *id, langs, interactive)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			*id = resolved
+		}
+	}
+
+	// Catch a compiler meant for another language before the server gives a confusing error
+	if compilers != nil {
+		checks := []Options{opts}
+		if len(compilerIDs) > 0 {
+			checks = nil
+			for _, id := range compilerIDs {
+				o := opts
+				o.Compiler = id
+				checks = append(checks, o)
+			}
+		}
+		for _, o := range checks {
+			for _, filePath := range filePaths {
+				if err := checkCompilerLang(o, compilers, filePath); err != nil {
+					if *strict {
+						fmt.Fprintf(stderr, "Error: %v\n", err)
+						os.Exit(1)
+					}
+					fmt.Fprintln(stderr, colorize("33", fmt.Sprintf("Warning: %v", err)))
+				}
+			}
+		}
+	}
+
+	// Cancel in-flight requests and stop watching on Ctrl-C / SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		if *diffCompiler != "" {
+			optsB := opts
+			optsB.Compiler = *diffCompiler
+			code, err := compileDiff(ctx, stdout, opts, optsB, opts.Compiler, optsB.Compiler, filePaths[0])
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(code)
+		}
+		if *diffArgs != "" {
+			optsB := opts
+			optsB.Args = *diffArgs
+			code, err := compileDiff(ctx, stdout, opts, optsB, fmt.Sprintf("-args=%q", opts.Args), fmt.Sprintf("-args=%q", optsB.Args), filePaths[0])
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(code)
+		}
+
+		if *since {
+			exitCode := 0
+			for i, filePath := range filePaths {
+				if len(filePaths) > 1 {
+					printFileHeader(stdout, filePath, i > 0)
+				}
+				code, err := compileSince(ctx, stdout, opts, filePath)
+				if err != nil {
+					fmt.Fprintf(stderr, "Error: %v\n", err)
+					code = 1
+				}
+				if code != 0 && exitCode == 0 {
+					exitCode = code
+				}
+			}
+			os.Exit(exitCode)
+		}
+
+		if len(compilerIDs) > 0 {
+			os.Exit(compileVariants(ctx, stdout, filePaths[0], compilerVariants(opts, compilerIDs)))
+		}
+		if len(targets) > 0 {
+			variants, err := targetVariants(opts, ceLanguage(getLangFromFile(sourceName(opts, filePaths[0]), opts.Lang)), targets)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(compileVariants(ctx, stdout, filePaths[0], variants))
+		}
+		if *count > 1 {
+			result, err := benchmark(ctx, stdout, opts, filePaths[0], *count)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(result.ExitCode())
+		}
+
+		if len(filePaths) == 1 {
+			result, err := compile(ctx, stdout, opts, filePaths[0])
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(result.ExitCode())
+		}
+
+		// Several files: compile each, exiting nonzero if any of them failed
+		exitCode := 0
+		for i, filePath := range filePaths {
+			printFileHeader(stdout, filePath, i > 0)
+			code := 1
+			result, err := compile(ctx, stdout, opts, filePath)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+			} else {
+				code = result.ExitCode()
+			}
+			if code != 0 && exitCode == 0 {
+				exitCode = code
+			}
+		}
+		os.Exit(exitCode)
+	}
+
+	if *tui {
+		if err := runTUI(ctx, opts, filePaths[0]); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 		return
 	}
 
-	if err := watch(*server, *compiler, filePath, *args, *showSource, *projectRoot); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if err := watch(ctx, stdout, opts, filePaths); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,948 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestMain(m *testing.M) {
+	// Plain text keeps expected output readable; a private cache directory
+	// keeps tests away from the user's cached responses
+	colorEnabled = false
+	dir, err := os.MkdirTemp("", "cet-test-cache")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CACHE_HOME", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeServer is a Compiler Explorer stand-in that records every compile
+// request and answers each with respond
+type fakeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []CompileRequest
+	paths    []string
+}
+
+func newFakeServer(t *testing.T, respond func(req CompileRequest) CompileResponse) *fakeServer {
+	t.Helper()
+	s := &fakeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req CompileRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.paths = append(s.paths, r.URL.Path)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respond(req))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// received returns the compile requests seen so far, with their URL paths
+func (s *fakeServer) received() ([]CompileRequest, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CompileRequest(nil), s.requests...), append([]string(nil), s.paths...)
+}
+
+// asmResponse is a successful compile with the given assembly lines
+func asmResponse(lines ...string) CompileResponse {
+	resp := CompileResponse{}
+	for _, line := range lines {
+		resp.Asm = append(resp.Asm, AsmLine{Text: line})
+	}
+	return resp
+}
+
+// testOptions are the options main would build with default flags, pointed
+// at server and with the response cache off
+func testOptions(server *httptest.Server) Options {
+	return Options{
+		Server:      server.URL,
+		Compiler:    "g132",
+		Filters:     Filters{CommentOnly: true, Demangle: true, Directives: true, Intel: true, Labels: true},
+		NoMultifile: true,
+		NoCache:     true,
+		API:         newAPIClient(io.Discard, server.URL, server.Client(), nil, 0, false, false),
+		Stderr:      io.Discard,
+	}
+}
+
+// withStdin runs fn with os.Stdin reading input
+func withStdin(t *testing.T, input string, fn func()) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		w.WriteString(input)
+		w.Close()
+	}()
+	saved := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = saved
+		r.Close()
+	}()
+	fn()
+}
+
+func TestFilterFlags(t *testing.T) {
+	defaults := map[string]bool{
+		"binary": false, "commentOnly": true, "demangle": true, "directives": true,
+		"intel": true, "labels": true, "trim": false, "execute": false,
+	}
+	tests := []struct {
+		args  []string
+		field string // the filters field that changes from its default
+	}{
+		{nil, ""},
+		{[]string{"-intel=false"}, "intel"},
+		{[]string{"-labels=false"}, "labels"},
+		{[]string{"-directives=false"}, "directives"},
+		{[]string{"-comments=false"}, "commentOnly"},
+		{[]string{"-demangle=false"}, "demangle"},
+		{[]string{"-trim"}, "trim"},
+		{[]string{"-binary"}, "binary"},
+	}
+	for _, tt := range tests {
+		fset := flag.NewFlagSet("cet", flag.ContinueOnError)
+		filters := filterFlags(fset)
+		if err := fset.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]bool
+		if err := json.Unmarshal(marshaledOptions(t, CompileRequest{Options: CompileOptions{Filters: filters()}})["filters"], &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(defaults) {
+			t.Errorf("%v: sent filters %v, want the fields %v", tt.args, got, defaults)
+		}
+		for field, def := range defaults {
+			want := def != (field == tt.field)
+			if v, ok := got[field]; !ok || v != want {
+				t.Errorf("%v: filters.%s = %v (sent %v), want %v", tt.args, field, v, ok, want)
+			}
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"-n 10", []string{"-n", "10"}},
+		{"  a\tb \n c ", []string{"a", "b", "c"}},
+		{`'hello world' x`, []string{"hello world", "x"}},
+		{`"a \"b\" c" d`, []string{`a "b" c`, "d"}},
+		{`"back\slash"`, []string{`back\slash`}},
+		{`'it''s'`, []string{"its"}},
+		{`a\ b`, []string{"a b"}},
+		{`''`, []string{""}},
+		{`--name="x y"z`, []string{"--name=x yz"}},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if err != nil {
+			t.Errorf("splitArgs(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{`'open`, `"open`, `trailing\`} {
+		if _, err := splitArgs(in); err == nil {
+			t.Errorf("splitArgs(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+// marshaledOptions is the "options" object of req as sent to the server
+func marshaledOptions(t *testing.T, req CompileRequest) map[string]json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Options map[string]json.RawMessage `json:"options"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got.Options
+}
+
+func TestExecuteParametersJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		execute bool
+		want    string // executeParameters in the marshaled options, "" if absent
+	}{
+		{"execute", true, `{"args":["-n","hello world"],"stdin":"input\n"}`},
+		{"compile only", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions(newFakeServer(t, nil).Server)
+			opts.Filters.Execute = tt.execute
+			opts.ProgArgs = []string{"-n", "hello world"}
+			opts.Stdin = "input\n"
+			req, err := buildRequest(opts, stdinPath, []byte("int main() {}\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			params, ok := marshaledOptions(t, req)["executeParameters"]
+			switch {
+			case tt.want == "" && ok:
+				t.Errorf("executeParameters sent without -execute: %s", params)
+			case tt.want != "" && string(params) != tt.want:
+				t.Errorf("executeParameters = %s, want %s", params, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileStdin(t *testing.T) {
+	const source = "int square(int x) { return x * x; }\n"
+	server := newFakeServer(t, func(req CompileRequest) CompileResponse { return asmResponse("square:", "  imul edi, edi") })
+	opts := testOptions(server.Server)
+	opts.Lang = "c"
+	opts.NoMultifile = false // stdin never collects project files
+
+	// A project file in the working directory must not be picked up
+	dir := t.TempDir()
+	writeFile(t, dir, "other.c", "int other;\n")
+	t.Chdir(dir)
+
+	var out bytes.Buffer
+	var err error
+	withStdin(t, source, func() {
+		_, err = compile(context.Background(), &out, opts, stdinPath)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests, _ := server.received()
+	if len(requests) != 1 {
+		t.Fatalf("server got %d requests, want 1", len(requests))
+	}
+	if req := requests[0]; req.Source != source || len(req.Files) != 0 {
+		t.Errorf("request has source %q and %d files, want %q and none", req.Source, len(req.Files), source)
+	}
+	if !strings.Contains(out.String(), "imul edi, edi") {
+		t.Errorf("output lacks the assembly:\n%s", out.String())
+	}
+}
+
+// collectNames collects the C files of the project around dir/main.c with
+// default options, returning their request names in walk order
+func collectNames(t *testing.T, dir string, maxFileSize int64, stderr io.Writer) []string {
+	t.Helper()
+	mainFile := filepath.Join(dir, "main.c")
+	include := projectFileFilter(Options{}, mainFile, dir)
+	files, err := collectProjectFiles(stderr, dir, mainFile, dir, nil, include, maxFileSize, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Filename)
+	}
+	return names
+}
+
+func TestCollectProjectFilesMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "main.c", "int main() {}\n")
+	writeFile(t, dir, "small.c", "int small;\n")
+	writeFile(t, dir, "big.c", strings.Repeat("x", 2048))
+
+	var warnings strings.Builder
+	if got, want := collectNames(t, dir, 1024, &warnings), []string{"small.c"}; !slices.Equal(got, want) {
+		t.Errorf("collected %q, want %q", got, want)
+	}
+	if !strings.Contains(warnings.String(), "Skipping big.c") {
+		t.Errorf("no note about big.c in %q", warnings.String())
+	}
+	if got, want := collectNames(t, dir, 0, io.Discard), []string{"big.c", "small.c"}; !slices.Equal(got, want) {
+		t.Errorf("with no limit collected %q, want %q", got, want)
+	}
+}
+
+func TestBuildRequestMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "main.c", "int main() {}\n")
+	writeFile(t, dir, "a.c", strings.Repeat("a", 600))
+	writeFile(t, dir, "b.c", strings.Repeat("b", 600))
+
+	opts := testOptions(newFakeServer(t, nil).Server)
+	opts.NoMultifile = false
+	opts.MaxSize = 1000
+	_, err := buildRequest(opts, filepath.Join(dir, "main.c"), []byte("int main() {}\n"))
+	if err == nil || !strings.Contains(err.Error(), "-max-size") {
+		t.Errorf("got error %v, want the -max-size limit", err)
+	}
+
+	opts.MaxSize = 2000
+	req, err := buildRequest(opts, filepath.Join(dir, "main.c"), []byte("int main() {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Files) != 2 {
+		t.Errorf("request has %d files, want 2", len(req.Files))
+	}
+}
+
+func TestBuildRequestFilename(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "main.c", "int main() {}\n")
+	writeFile(t, dir, "util.c", "int util;\n")
+	writeFile(t, dir, "other.c", "int other;\n")
+	mainFile := filepath.Join(dir, "main.c")
+	opts := testOptions(newFakeServer(t, nil).Server)
+	opts.NoMultifile = false
+
+	tests := []struct {
+		name, filename, path string
+		want                 string   // the request's filename
+		files                []string // its files
+	}{
+		{"base name by default", "", mainFile, "main.c", []string{"other.c", "util.c"}},
+		{"-filename", "gen.cpp", mainFile, "gen.cpp", []string{"other.c", "util.c"}},
+		{"the source takes a project file's name", "util.c", mainFile, "util.c", []string{"other.c"}},
+		{"stdin has no name", "", stdinPath, "", nil},
+		{"stdin with -filename", "gen.cpp", stdinPath, "gen.cpp", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := opts
+			opts.Filename = tt.filename
+			req, err := buildRequest(opts, tt.path, []byte("int main() {}\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sent struct {
+				Filename *string `json:"filename"`
+			}
+			if err := json.Unmarshal(data, &sent); err != nil {
+				t.Fatal(err)
+			}
+			if got := sent.Filename; (got == nil) != (tt.want == "") || (got != nil && *got != tt.want) {
+				t.Errorf("sent filename %v, want %q (omitted if empty)", got, tt.want)
+			}
+			var files []string
+			for _, f := range req.Files {
+				files = append(files, f.Filename)
+			}
+			slices.Sort(files)
+			if !slices.Equal(files, tt.files) {
+				t.Errorf("files %q, want %q", files, tt.files)
+			}
+		})
+	}
+
+	opts.Filename = "util.c"
+	opts.ExtraFiles = []extraFile{{path: filepath.Join(dir, "other.c"), name: "util.c"}}
+	if _, err := buildRequest(opts, mainFile, []byte("int main() {}\n")); err == nil || !strings.Contains(err.Error(), "main source's name") {
+		t.Errorf("a -file named like the main source: got %v, want an error", err)
+	}
+}
+
+func TestShouldRecompile(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "proj")
+	mainFile := filepath.Join(root, "src", "main.zig")
+	include := projectFileFilter(Options{}, mainFile, root)
+	skipDirs := skipDirSet(nil)
+	event := func(op fsnotify.Op, rel string) fsnotify.Event {
+		return fsnotify.Event{Name: filepath.Join(root, filepath.FromSlash(rel)), Op: op}
+	}
+
+	tests := []struct {
+		name  string
+		event fsnotify.Event
+		want  bool
+	}{
+		{"write to the main file", event(fsnotify.Write, "src/main.zig"), true},
+		{"create of a project file", event(fsnotify.Create, "lib/util.zig"), true},
+		{"write and chmod together", event(fsnotify.Write|fsnotify.Chmod, "src/main.zig"), true},
+		{"chmod only", event(fsnotify.Chmod, "src/main.zig"), false},
+		{"remove", event(fsnotify.Remove, "src/main.zig"), false},
+		{"rename", event(fsnotify.Rename, "src/main.zig"), false},
+		{"other extension", event(fsnotify.Write, "src/notes.md"), false},
+		{"editor swap file", event(fsnotify.Write, "src/.main.zig.swp"), false},
+		{"skipped directory", event(fsnotify.Write, ".zig-cache/o/gen.zig"), false},
+		{"nested skipped directory", event(fsnotify.Write, "lib/node_modules/x.zig"), false},
+		{"outside the root", fsnotify.Event{Name: filepath.Join(filepath.Dir(root), "other.zig"), Op: fsnotify.Write}, true},
+		{"outside the root, other extension", fsnotify.Event{Name: filepath.Join(filepath.Dir(root), "other.c"), Op: fsnotify.Write}, false},
+	}
+	for _, tt := range tests {
+		if got := shouldRecompile(tt.event, include, root, skipDirs); got != tt.want {
+			t.Errorf("%s: shouldRecompile(%v) = %v, want %v", tt.name, tt.event, got, tt.want)
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to read while watch writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startWatch runs watch on filePath in the background, returning its output
+// and a channel that receives its result once ctx is cancelled
+func startWatch(ctx context.Context, opts Options, filePath string) (*syncBuffer, <-chan error) {
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() { done <- watch(ctx, out, opts, []string{filePath}) }()
+	return out, done
+}
+
+func TestWatchStopsOnCancel(t *testing.T) {
+	server := newFakeServer(t, func(req CompileRequest) CompileResponse { return asmResponse("main:", "  ret") })
+	opts := testOptions(server.Server)
+	opts.Debounce = 10 * time.Millisecond
+	dir := t.TempDir()
+	writeFile(t, dir, "main.c", "int main() {}\n")
+	filePath := filepath.Join(dir, "main.c")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out, done := startWatch(ctx, opts, filePath)
+	waitFor(t, "the initial compile", func() bool { r, _ := server.received(); return len(r) == 1 })
+
+	writeFile(t, dir, "main.c", "int main() { return 1; }\n")
+	waitFor(t, "the recompile", func() bool { r, _ := server.received(); return len(r) == 2 })
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("watch returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not return after ctx was cancelled")
+	}
+	if !strings.Contains(out.String(), "Stopped watching") {
+		t.Errorf("output lacks the stop message:\n%s", out.String())
+	}
+}
+
+func TestWatchMainFileOutsideGlobs(t *testing.T) {
+	server := newFakeServer(t, func(req CompileRequest) CompileResponse { return asmResponse("main:", "  ret") })
+	opts := testOptions(server.Server)
+	opts.Debounce = 10 * time.Millisecond
+	opts.NoMultifile = false
+	var err error
+	if opts.Include, err = compileGlobs([]string{"lib/**/*.c"}); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Exclude, err = compileGlobs([]string{"main.c"}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeFile(t, dir, "main.c", "int main() {}\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startWatch(ctx, opts, filepath.Join(dir, "main.c"))
+	waitFor(t, "the initial compile", func() bool { r, _ := server.received(); return len(r) == 1 })
+	writeFile(t, dir, "main.c", "int main() { return 1; }\n")
+	waitFor(t, "the recompile of the main file", func() bool { r, _ := server.received(); return len(r) == 2 })
+}
+
+func TestGetLangFromFile(t *testing.T) {
+	tests := []struct {
+		path, override, want string
+	}{
+		{"main.zig", "", "zig"},
+		{"main.c", "", "c"},
+		{"main.cpp", "", "cpp"},
+		{"main.cc", "", "cpp"},
+		{"main.cxx", "", "cpp"},
+		{"util.h", "", "cpp"},
+		{"util.hpp", "", "cpp"},
+		{"kernel.cu", "", "cpp"},
+		{"start.S", "", "gas"}, // extensions are matched case-insensitively
+		{"start.s", "", "gas"},
+		{"MAIN.CPP", "", "cpp"},
+		{"mod.ll", "", "llvm"},
+		{"src/lib.rs", "", "rust"},
+		{"main.go", "", "go"},
+		{"Main.java", "", "java"},
+		{"solver.f90", "", "fortran"},
+		{"dir.v2/main", "", ""},
+		{"README", "", ""},
+		{"notes.md", "", ""},
+		{"main.c", "cpp", "cpp"}, // -lang wins
+		{"README", "zig", "zig"},
+	}
+	for _, tt := range tests {
+		if got := getLangFromFile(tt.path, tt.override); got != tt.want {
+			t.Errorf("getLangFromFile(%q, %q) = %q, want %q", tt.path, tt.override, got, tt.want)
+		}
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(asmResponse("main:", "  ret"))
+	}))
+	defer server.Close()
+
+	headers, err := buildHeaders([]string{"X-Team = compilers", "X-Trace=a=b"}, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log strings.Builder
+	opts := Options{
+		Compiler:    "g132",
+		NoCache:     true,
+		NoMultifile: true,
+		Verbose:     true,
+		API:         newAPIClient(&log, server.URL, server.Client(), headers, 0, false, true),
+		Stderr:      &log,
+	}
+	if _, err := compileRequest(context.Background(), io.Discard, opts, "main.c", nil, CompileRequest{Source: "int main() {}\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"Authorization": "Bearer s3cret", "X-Team": "compilers", "X-Trace": "a=b"} {
+		if v := got.Get(name); v != want {
+			t.Errorf("request header %s = %q, want %q", name, v, want)
+		}
+	}
+	if strings.Contains(log.String(), "s3cret") {
+		t.Errorf("-verbose output leaks the token:\n%s", log.String())
+	}
+	if !strings.Contains(log.String(), "Authorization: <redacted>") || !strings.Contains(log.String(), "X-Team: compilers") {
+		t.Errorf("-verbose output lacks the headers:\n%s", log.String())
+	}
+}
+
+func TestBuildHeadersInvalid(t *testing.T) {
+	if _, err := buildHeaders([]string{"no-equals-sign"}, ""); err == nil {
+		t.Error("buildHeaders accepted a pair without '='")
+	}
+}
+
+func TestCompileReusesConnection(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(asmResponse("main:", "  ret"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client, err := newHTTPClient(10*time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{
+		Compiler:    "g132",
+		NoCache:     true,
+		NoMultifile: true,
+		API:         newAPIClient(io.Discard, server.URL, client, nil, 0, false, false),
+		Stderr:      io.Discard,
+	}
+	for range 3 {
+		if _, err := compileRequest(context.Background(), io.Discard, opts, "main.c", nil, CompileRequest{Source: "int main() {}\n"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Errorf("3 compiles opened %d connections, want 1 kept alive", conns)
+	}
+}
+
+func TestTidyAsm(t *testing.T) {
+	src := &AsmSource{Line: 3}
+	in := []AsmLine{
+		{Text: "square:  "},
+		{Text: "        imul    edi, edi\t", Source: src},
+		{Text: ""},
+		{Text: "   "},
+		{Text: "\t"},
+		{Text: "main:"},
+		{Text: ""},
+		{Text: "        ret"},
+		{Text: "  "},
+	}
+	want := []AsmLine{
+		{Text: "square:"},
+		{Text: "        imul    edi, edi", Source: src},
+		{Text: ""},
+		{Text: "main:"},
+		{Text: ""},
+		{Text: "        ret"},
+		{Text: ""},
+	}
+	got := tidyAsm(in)
+	if len(got) != len(want) {
+		t.Fatalf("tidyAsm returned %d lines, want %d: %q", len(got), len(want), asmTexts(got))
+	}
+	for i := range want {
+		if got[i].Text != want[i].Text || got[i].Source != want[i].Source {
+			t.Errorf("line %d = %q (source %v), want %q (source %v)", i, got[i].Text, got[i].Source, want[i].Text, want[i].Source)
+		}
+	}
+	if in[0].Text != "square:  " {
+		t.Error("tidyAsm modified its input")
+	}
+	if got := tidyAsm(nil); len(got) != 0 {
+		t.Errorf("tidyAsm(nil) = %q, want nothing", asmTexts(got))
+	}
+}
+
+func TestProjectSearchDirZigBuild(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "proj/build.zig", "pub fn build(b: *@import(\"std\").Build) void {}\n")
+	writeFile(t, dir, "proj/src/main.zig", "export fn f() void {}\n")
+	writeFile(t, dir, "loose/main.zig", "export fn f() void {}\n")
+	writeFile(t, dir, "proj/src/main.c", "int main() {}\n")
+
+	tests := []struct {
+		name     string
+		file     string
+		zigBuild bool
+		root     string
+		want     string
+	}{
+		{"nearest build.zig", "proj/src/main.zig", true, "", "proj"},
+		{"no build script", "loose/main.zig", true, "", "loose"},
+		{"detection off", "proj/src/main.zig", false, "", "proj/src"},
+		{"not a Zig source", "proj/src/main.c", true, "", "proj/src"},
+		{"-root wins", "proj/src/main.zig", true, filepath.Join(dir, "proj/src"), "proj/src"},
+	}
+	for _, tt := range tests {
+		opts := Options{ZigBuild: tt.zigBuild, ProjectRoot: tt.root}
+		got, err := projectSearchDir(opts, filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if want := filepath.Join(dir, tt.want); got != want {
+			t.Errorf("%s: projectSearchDir = %s, want %s", tt.name, got, want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		resp CompileResponse
+		want []string // in this order in the output
+		code int
+	}{
+		{
+			name: "success",
+			resp: asmResponse("square(int):", "        imul    edi, edi", "        mov     eax, edi", "        ret"),
+			want: []string{"━━━ Assembly ━━━", "square(int):", "imul    edi, edi", "ret"},
+		},
+		{
+			name: "failure",
+			resp: CompileResponse{Code: 1, Stderr: []OutputLine{{Text: "<source>:1:1: error: unknown type name 'in'"}}},
+			want: []string{"main.c:1:1: error: unknown type name 'in'", "✗ Compilation failed (exit code 1)"},
+			code: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t, func(CompileRequest) CompileResponse { return tt.resp })
+			dir := t.TempDir()
+			writeFile(t, dir, "main.c", "int square(int x) { return x * x; }\n")
+
+			var out bytes.Buffer
+			result, err := compile(context.Background(), &out, testOptions(server.Server), filepath.Join(dir, "main.c"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.ExitCode() != tt.code {
+				t.Errorf("exit code %d, want %d", result.ExitCode(), tt.code)
+			}
+			text := out.String()
+			if strings.Contains(text, "\033[") {
+				t.Errorf("output has color codes with color off:\n%q", text)
+			}
+			rest := text
+			for _, want := range tt.want {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Fatalf("output lacks %q after the earlier lines:\n%s", want, text)
+				}
+				rest = rest[i+len(want):]
+			}
+		})
+	}
+}
+
+func TestOverridesJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []string
+		want  string // overrides in the marshaled options, "" if absent
+	}{
+		{"none", nil, ""},
+		{"several", []string{"arch=aarch64", " std = c++20", "env=A=1"}, `[{"name":"arch","value":"aarch64"},{"name":"std","value":"c++20"},{"name":"env","value":"A=1"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrides, err := parseOverrides(tt.specs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := testOptions(newFakeServer(t, nil).Server)
+			opts.Overrides = overrides
+			req, err := buildRequest(opts, stdinPath, []byte("int main() {}\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := marshaledOptions(t, req)["overrides"]
+			switch {
+			case tt.want == "" && ok:
+				t.Errorf("overrides sent though none were given: %s", got)
+			case tt.want != "" && string(got) != tt.want:
+				t.Errorf("overrides = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseOverrides([]string{"=x"}); err == nil {
+		t.Error("parseOverrides accepted an empty name")
+	}
+}
+
+func TestWatchRateLimited(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		first := len(times) == 1
+		mu.Unlock()
+		if first {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(asmResponse("main:", "  ret"))
+	}))
+	defer server.Close()
+	requests := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(times)
+	}
+
+	opts := testOptions(server)
+	opts.Debounce = 10 * time.Millisecond
+	dir := t.TempDir()
+	writeFile(t, dir, "main.c", "int main() {}\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out, done := startWatch(ctx, opts, filepath.Join(dir, "main.c"))
+	waitFor(t, "the rate-limited compile", func() bool { return strings.Contains(out.String(), "will compile then") })
+	if !strings.Contains(out.String(), "rate limited by the server, retry after 1 seconds") {
+		t.Errorf("output lacks the rate limit error:\n%s", out.String())
+	}
+
+	// A save during the Retry-After window waits for it to pass
+	writeFile(t, dir, "main.c", "int main() { return 1; }\n")
+	waitFor(t, "the recompile", func() bool { return requests() == 2 })
+	mu.Lock()
+	waited := times[1].Sub(times[0])
+	mu.Unlock()
+	if waited < 900*time.Millisecond {
+		t.Errorf("recompiled %s after the 429, want Retry-After's 1s", waited)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestMergeFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "override/util.h", "// from -file\n")
+	writeFile(t, dir, "gen.h", "// generated\n")
+	collected := []FileEntry{
+		{Filename: "util.h", Contents: "// collected\n"},
+		{Filename: "lib/other.h", Contents: "// other\n"},
+	}
+	extra, err := parseExtraFiles([]string{filepath.Join(dir, "override/util.h"), filepath.Join(dir, "gen.h") + "=include/gen.h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := mergeFiles(collected, extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileEntry{
+		{Filename: "lib/other.h", Contents: "// other\n"},
+		{Filename: "util.h", Contents: "// from -file\n"}, // -file wins the collision
+		{Filename: "include/gen.h", Contents: "// generated\n"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("mergeFiles = %+v, want %+v", got, want)
+	}
+	if collected[0].Contents != "// collected\n" {
+		t.Error("mergeFiles modified the collected files")
+	}
+
+	twice, err := parseExtraFiles([]string{filepath.Join(dir, "gen.h"), filepath.Join(dir, "override/util.h") + "=gen.h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mergeFiles(nil, twice); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("two -files named gen.h: got %v, want an error", err)
+	}
+}
+
+func TestCollectProjectFilesNames(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "src/main.c", "int main() {}\n")
+	writeFile(t, dir, "src/net/http.c", "int http;\n")
+	writeFile(t, dir, "lib/deep/er/util.c", "int util;\n")
+
+	// Names are relative to the main file's directory, with forward slashes
+	// (see TestSlashName for the conversion from another OS separator)
+	mainFile := filepath.Join(dir, "src", "main.c")
+	include := projectFileFilter(Options{}, mainFile, dir)
+	files, err := collectProjectFiles(io.Discard, dir, mainFile, filepath.Dir(mainFile), nil, include, 0, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, f.Filename)
+	}
+	if want := []string{"../lib/deep/er/util.c", "net/http.c"}; !slices.Equal(got, want) {
+		t.Errorf("collected %q, want %q", got, want)
+	}
+}
+
+func TestSlashName(t *testing.T) {
+	tests := []struct {
+		rel  string
+		sep  byte
+		want string
+	}{
+		{`..\lib\deep\er\util.c`, '\\', "../lib/deep/er/util.c"},
+		{`net\http.c`, '\\', "net/http.c"},
+		{"util.c", '\\', "util.c"},
+		{"net/http.c", '/', "net/http.c"},
+		{`odd\name.c`, '/', `odd\name.c`}, // a backslash is part of a Unix file name
+	}
+	for _, tt := range tests {
+		if got := slashName(tt.rel, tt.sep); got != tt.want {
+			t.Errorf("slashName(%q, %q) = %q, want %q", tt.rel, tt.sep, got, tt.want)
+		}
+	}
+}
+
+func TestCollectProjectFilesSkipsBinary(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "main.c", "int main() {}\n")
+	writeFile(t, dir, "text.c", "// héllo, UTF-8 is fine\nint text;\n")
+	writeFile(t, dir, "object.c", "\x7fELF\x02\x01\x01\x00\x00\x00")
+	writeFile(t, dir, "latin1.c", "// caf\xe9\n")
+
+	var notes strings.Builder
+	mainFile := filepath.Join(dir, "main.c")
+	include := projectFileFilter(Options{}, mainFile, dir)
+	files, err := collectProjectFiles(&notes, dir, mainFile, dir, nil, include, 0, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Filename != "text.c" {
+		t.Errorf("collected %+v, want only text.c", files)
+	}
+	for _, name := range []string{"object.c", "latin1.c"} {
+		if !strings.Contains(notes.String(), "Skipping "+name+": binary or not UTF-8") {
+			t.Errorf("no -verbose note about %s in %q", name, notes.String())
+		}
+	}
+
+	// Without -verbose the skip is silent
+	notes.Reset()
+	if _, err := collectProjectFiles(&notes, dir, mainFile, dir, nil, include, 0, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if notes.Len() > 0 {
+		t.Errorf("notes without -verbose: %q", notes.String())
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// variantWorkers bounds how many -compilers or -targets requests are in flight at once
+const variantWorkers = 4
+
+// variant is one of several compiles of the same file, printed under label
+type variant struct {
+	label string
+	opts  Options
+}
+
+// compilerVariants compiles with each of the -compilers IDs
+func compilerVariants(opts Options, compilers []string) []variant {
+	var variants []variant
+	for _, id := range compilers {
+		o := opts
+		o.Compiler = id
+		variants = append(variants, variant{id, o})
+	}
+	return variants
+}
+
+// targetFlags is how each language's compilers spell the target triple, as a
+// format for the triple (C, C++ and CUDA assume clang; GCC has no such flag)
+var targetFlags = map[string]string{
+	"zig":   "-target %s",
+	"c":     "--target=%s",
+	"c++":   "--target=%s",
+	"cuda":  "--target=%s",
+	"rust":  "--target %s",
+	"swift": "-target %s",
+	"d":     "-mtriple=%s",
+}
+
+// targetVariants compiles for each of the -targets triples by appending the
+// language's target flag to -args
+func targetVariants(opts Options, lang string, targets []string) ([]variant, error) {
+	format, ok := targetFlags[lang]
+	if !ok {
+		return nil, fmt.Errorf("-targets does not know how %q compilers take a target (pass it in -args instead)", lang)
+	}
+	var variants []variant
+	for _, target := range targets {
+		o := opts
+		o.Args = strings.TrimSpace(opts.Args + " " + fmt.Sprintf(format, target))
+		variants = append(variants, variant{target, o})
+	}
+	return variants, nil
+}
+
+// compileVariants compiles the file once per variant concurrently, printing
+// every result under its label in the order given (a result waits for those
+// before it). The source is read once for all of them, so stdin works too.
+// The exit code is the first nonzero one.
+func compileVariants(ctx context.Context, w io.Writer, filePath string, variants []variant) int {
+	source, err := readSource(filePath)
+	if err != nil {
+		fmt.Fprintf(variants[0].opts.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	type job struct {
+		out    bytes.Buffer
+		result *compileResult
+		err    error
+		done   chan struct{}
+	}
+	jobs := make([]*job, len(variants))
+	queue := make(chan int)
+	for i := range jobs {
+		jobs[i] = &job{done: make(chan struct{})}
+	}
+
+	var wg sync.WaitGroup
+	for range min(variantWorkers, len(variants)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				j := jobs[i]
+				opts := variants[i].opts
+				opts.noSpinner = true
+				if p := prepareSource(opts, filePath, source); p.err != nil {
+					j.err = p.err
+				} else {
+					j.result, j.err = compileRequest(ctx, &j.out, opts, filePath, p.source, p.req)
+				}
+				close(j.done)
+			}
+		}()
+	}
+	go func() {
+		for i := range jobs {
+			queue <- i
+		}
+		close(queue)
+	}()
+
+	exitCode := 0
+	for i, j := range jobs {
+		<-j.done
+		printFileHeader(w, variants[i].label, i > 0)
+		j.out.WriteTo(w)
+		code := 1
+		if j.err != nil {
+			fmt.Fprintf(variants[i].opts.Stderr, "Error: %v\n", j.err)
+		} else {
+			code = j.result.ExitCode()
+		}
+		if code != 0 && exitCode == 0 {
+			exitCode = code
+		}
+	}
+	wg.Wait()
+	return exitCode
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCompileVariantsStdinSharesSource(t *testing.T) {
+	const source = "int f() { return 1; }\n"
+	server := newFakeServer(t, func(req CompileRequest) CompileResponse { return asmResponse("f:", "  ret") })
+	opts := testOptions(server.Server)
+	opts.Lang = "c"
+
+	tests := []struct {
+		name     string
+		variants func() []variant
+	}{
+		{"compilers", func() []variant { return compilerVariants(opts, []string{"a", "b", "c"}) }},
+		{"targets", func() []variant {
+			variants, err := targetVariants(opts, "c", []string{"x86_64-linux", "aarch64-linux", "riscv64-linux"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return variants
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := server.received()
+			var out bytes.Buffer
+			var code int
+			withStdin(t, source, func() {
+				code = compileVariants(context.Background(), &out, stdinPath, tt.variants())
+			})
+			if code != 0 {
+				t.Fatalf("exit code %d, output:\n%s", code, out.String())
+			}
+			requests, paths := server.received()
+			requests, paths = requests[len(before):], paths[len(before):]
+			if len(requests) != 3 {
+				t.Fatalf("server got %d requests, want 3", len(requests))
+			}
+			for i, req := range requests {
+				if req.Source != source {
+					t.Errorf("request to %s got source %q, want %q", path.Dir(paths[i]), req.Source, source)
+				}
+			}
+			if n := strings.Count(out.String(), "  ret"); n != 3 {
+				t.Errorf("output has %d assembly listings, want 3:\n%s", n, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw is not implemented on this platform, so -tui is unavailable
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("-tui is not supported on this platform")
+}
+
+// notifyResize is not implemented on this platform; the layout keeps its starting size
+func notifyResize(ch chan<- os.Signal) {}
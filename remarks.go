@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+)
+
+// remarkColor colors a remark by whether the optimization was applied
+func remarkColor(optType string) string {
+	switch optType {
+	case "Passed":
+		return "32"
+	case "Missed":
+		return "31"
+	default:
+		return "2"
+	}
+}
+
+// printRemarks prints optimization remarks grouped by source line, with the
+// line's text shown above its remarks when it belongs to the main file.
+// projectFiles are the other uploaded files, whose lines can't be looked up.
+func printRemarks(w io.Writer, remarks []OptRemark, sourceLines []string, projectFiles []FileEntry) {
+	fmt.Fprintln(w, "\n"+colorize("36", "━━━ Optimization Remarks ━━━"))
+	if len(remarks) == 0 {
+		fmt.Fprintln(w, colorize("2", "(no remarks; the compiler may not support them)"))
+		return
+	}
+
+	// Project files are uploaded under their relative names; anything else is the main file
+	other := make(map[string]bool, len(projectFiles))
+	for _, f := range projectFiles {
+		other[path.Base(f.Filename)] = true
+	}
+
+	type location struct {
+		file string
+		line int
+	}
+	groups := make(map[location][]OptRemark)
+	var locs []location
+	for _, r := range remarks {
+		var loc location
+		if r.DebugLoc != nil {
+			loc = location{r.DebugLoc.File, r.DebugLoc.Line}
+		}
+		if _, ok := groups[loc]; !ok {
+			locs = append(locs, loc)
+		}
+		groups[loc] = append(groups[loc], r)
+	}
+	sort.Slice(locs, func(i, j int) bool {
+		if locs[i].file != locs[j].file {
+			return locs[i].file < locs[j].file
+		}
+		return locs[i].line < locs[j].line
+	})
+
+	for _, loc := range locs {
+		switch {
+		case loc.line == 0:
+			fmt.Fprintln(w, colorize("2", "     │ (no location)"))
+		case !other[path.Base(loc.file)] && loc.line <= len(sourceLines):
+			fmt.Fprintln(w, colorize("2", fmt.Sprintf("%4d │ %s", loc.line, sourceLines[loc.line-1])))
+		default:
+			fmt.Fprintln(w, colorize("2", fmt.Sprintf("%s:%d", loc.file, loc.line)))
+		}
+		for _, r := range groups[loc] {
+			fmt.Fprintln(w, "       "+colorize(remarkColor(r.OptType), fmt.Sprintf("%s: %s", r.Pass, r.DisplayString)))
+		}
+	}
+}
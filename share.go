@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"runtime"
+)
+
+// ClientState is the subset of Compiler Explorer's client state needed for a shortlink:
+// one session with the source and the selected compiler.
+type ClientState struct {
+	Sessions []Session `json:"sessions"`
+}
+
+type Session struct {
+	ID        int               `json:"id"`
+	Language  string            `json:"language"`
+	Source    string            `json:"source"`
+	Filename  string            `json:"filename,omitempty"`
+	Compilers []SessionCompiler `json:"compilers"`
+}
+
+type SessionCompiler struct {
+	ID        string       `json:"id"`
+	Options   string       `json:"options"`
+	Filters   Filters      `json:"filters"`
+	Libs      []SessionLib `json:"libs,omitempty"`
+	Overrides []Override   `json:"overrides,omitempty"`
+}
+
+// SessionLib is how client state spells a selected library
+type SessionLib struct {
+	Name string `json:"name"`
+	Ver  string `json:"ver"`
+}
+
+type shortenerResponse struct {
+	URL string `json:"url"`
+}
+
+// ceLanguage maps a chroma lexer name to the Compiler Explorer language ID
+func ceLanguage(lang string) string {
+	switch lang {
+	case "cpp":
+		return "c++"
+	case "gas":
+		return "assembly"
+	default:
+		return lang
+	}
+}
+
+// createShortLink registers the source, under its logical name, and compiler
+// settings with the server's shortener and returns the permalink
+func createShortLink(ctx context.Context, opts Options, source, name string) (string, error) {
+	var libs []SessionLib
+	for _, lib := range opts.Libraries {
+		libs = append(libs, SessionLib{Name: lib.ID, Ver: lib.Version})
+	}
+	state := ClientState{
+		Sessions: []Session{{
+			ID:       1,
+			Language: ceLanguage(getLangFromFile(name, opts.Lang)),
+			Source:   source,
+			Filename: name,
+			Compilers: []SessionCompiler{{
+				ID:        opts.Compiler,
+				Options:   opts.Args,
+				Filters:   opts.Filters,
+				Libs:      libs,
+				Overrides: opts.Overrides,
+			}},
+		}},
+	}
+
+	jsonData, err := json.Marshal(state)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal client state: %w", err)
+	}
+
+	body, status, err := opts.API.Post(ctx, "/api/shortener", jsonData)
+	if err != nil {
+		return "", err
+	}
+	if status == http.StatusNotFound || status == http.StatusMethodNotAllowed {
+		return "", fmt.Errorf("server %s does not support shortlinks (shortener disabled?)", opts.Server)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("shortener returned %d %s", status, http.StatusText(status))
+	}
+
+	var resp shortenerResponse
+	if err := json.Unmarshal(body, &resp); err != nil || resp.URL == "" {
+		return "", fmt.Errorf("shortener returned an unexpected response: %s", string(body[:min(200, len(body))]))
+	}
+	return resp.URL, nil
+}
+
+// openBrowser opens url in the default browser, warning if no launcher is available
+func openBrowser(stderr io.Writer, url string) {
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		name = "open"
+	case "windows":
+		name, args = "cmd", []string{"/c", "start", ""}
+	default:
+		name = "xdg-open"
+	}
+
+	if _, err := exec.LookPath(name); err != nil {
+		fmt.Fprintln(stderr, colorize("33", fmt.Sprintf("Warning: cannot open browser, %s not found", name)))
+		return
+	}
+	if err := exec.Command(name, append(args, url)...).Start(); err != nil {
+		fmt.Fprintln(stderr, colorize("33", fmt.Sprintf("Warning: cannot open browser: %v", err)))
+	}
+}
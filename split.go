@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// minSplitWidth is the narrowest terminal -split lays out side by side;
+// narrower ones get the stacked -interleave layout instead
+const minSplitWidth = 100
+
+// splitRow is one row of the -split layout: a source line (0 = none) beside an
+// assembly line (-1 = none)
+type splitRow struct {
+	src int
+	asm int
+}
+
+// splitRows pairs each run of assembly with the main-file line it came from.
+// Source lines without any assembly (comments, declarations) are placed where
+// the file order puts them, so the left column reads like the file.
+func splitRows(asm []AsmLine, sourceLines int) []splitRow {
+	mapped := make(map[int]bool)
+	for _, line := range asm {
+		if src := line.Source; src != nil && src.File == nil {
+			mapped[src.Line] = true
+		}
+	}
+
+	var rows []splitRow
+	unmappedUpTo := func(shown, n int) {
+		for ; shown < n; shown++ {
+			if !mapped[shown+1] {
+				rows = append(rows, splitRow{src: shown + 1, asm: -1})
+			}
+		}
+	}
+
+	shown, lastLine := 0, 0
+	for i, line := range asm {
+		src := line.Source
+		if src == nil || src.File != nil || src.Line == lastLine || src.Line < 1 || src.Line > sourceLines {
+			rows = append(rows, splitRow{asm: i})
+			continue
+		}
+		lastLine = src.Line
+		if src.Line > shown {
+			unmappedUpTo(shown, src.Line-1)
+			shown = src.Line
+		}
+		rows = append(rows, splitRow{src: src.Line, asm: i})
+	}
+	unmappedUpTo(shown, sourceLines)
+	return rows
+}
+
+// printSplit prints the source in a left column beside the assembly it
+// generates, each highlighted on its own and cut to fit half the terminal.
+// Terminals narrower than minSplitWidth get printInterleaved instead.
+func printSplit(asm []AsmLine, source, lang string, opts Options, p *asmPrinter) {
+	width := terminalWidth()
+	if width < minSplitWidth {
+		printInterleaved(asm, strings.Split(source, "\n"), p)
+		return
+	}
+
+	src := highlightLines(expandTabs(strings.TrimSuffix(source, "\n")), lang, opts)
+	code := highlightLines(expandTabs(strings.TrimSuffix(plainAsm(asm), "\n")), "gas", opts)
+
+	const gutter = 6 // "%4d  "
+	sep := colorize("2", " │ ")
+	leftWidth := (width - 3) / 2
+	rightWidth := width - 3 - leftWidth
+
+	for _, row := range splitRows(asm, len(splitLines(source))) {
+		left := strings.Repeat(" ", leftWidth)
+		if row.src > 0 {
+			left = colorize("2", fmt.Sprintf("%4d  ", row.src)) + fitWidth(src[row.src-1], leftWidth-gutter, true)
+		}
+		right := ""
+		if row.asm >= 0 {
+			right = fitWidth(code[row.asm], rightWidth, false)
+		}
+		fmt.Fprintln(p.w, strings.TrimRight(left+sep+right, " "))
+	}
+}
+
+// highlightLines highlights code and splits it into lines that each start
+// with the colors still active from the line before, so a token spanning lines
+// (a block comment) stays colored once the lines are printed apart
+func highlightLines(code, lang string, opts Options) []string {
+	lines := strings.Split(highlight(code, lang, opts.Style, opts.Formatter), "\n")
+	if !colorEnabled {
+		return lines
+	}
+	active := ""
+	for i, line := range lines {
+		lines[i] = active + line
+		for rest := line; ; {
+			start := strings.Index(rest, "\033[")
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(rest[start:], 'm')
+			if end < 0 {
+				break
+			}
+			seq := rest[start : start+end+1]
+			if seq == "\033[0m" {
+				active = ""
+			} else {
+				active += seq
+			}
+			rest = rest[start+end+1:]
+		}
+	}
+	return lines
+}
+
+// fitWidth cuts text with color escapes to width visible characters, ending
+// in "…" when something was cut, and with pad fills it out with spaces
+func fitWidth(text string, width int, pad bool) string {
+	var b strings.Builder
+	visible := 0
+	for i := 0; i < len(text); {
+		if strings.HasPrefix(text[i:], "\033[") {
+			end := strings.IndexByte(text[i:], 'm')
+			if end < 0 {
+				break
+			}
+			b.WriteString(text[i : i+end+1])
+			i += end + 1
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if visible == width-1 && visibleWidth(text[i+size:]) > 0 {
+			b.WriteString("…")
+			visible++
+			break
+		}
+		if visible == width {
+			break
+		}
+		b.WriteRune(r)
+		visible++
+		i += size
+	}
+	if strings.Contains(text, "\033[") {
+		b.WriteString("\033[0m")
+	}
+	if pad && visible < width {
+		b.WriteString(strings.Repeat(" ", width-visible))
+	}
+	return b.String()
+}
+
+// visibleWidth counts the characters of text that are not color escapes
+func visibleWidth(text string) int {
+	n := 0
+	for i := 0; i < len(text); {
+		if strings.HasPrefix(text[i:], "\033[") {
+			end := strings.IndexByte(text[i:], 'm')
+			if end < 0 {
+				return n
+			}
+			i += end + 1
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		n++
+		i += size
+	}
+	return n
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of four
+// columns, so column widths can be counted in characters
+func expandTabs(text string) string {
+	if !strings.Contains(text, "\t") {
+		return text
+	}
+	var b strings.Builder
+	col := 0
+	for _, r := range text {
+		switch r {
+		case '\t':
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		case '\n':
+			b.WriteRune(r)
+			col = 0
+		default:
+			b.WriteRune(r)
+			col++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// funcStat is the instruction count of a single function
+type funcStat struct {
+	Name         string
+	Instructions int
+}
+
+// isInstruction reports whether an assembly line is an actual instruction
+// rather than a label, directive or comment
+func isInstruction(text string) bool {
+	trimmed := strings.TrimSpace(text)
+	switch {
+	case trimmed == "":
+		return false
+	case strings.HasSuffix(trimmed, ":"):
+		return false
+	case strings.HasPrefix(trimmed, "."):
+		return false
+	case strings.HasPrefix(trimmed, "#"), strings.HasPrefix(trimmed, ";"), strings.HasPrefix(trimmed, "//"):
+		return false
+	}
+	return true
+}
+
+// asmStats counts instructions in total and per function, splitting at function labels.
+// Instructions before the first label are only counted in the total.
+func asmStats(asm []AsmLine) (int, []funcStat) {
+	total := 0
+	var funcs []funcStat
+	for _, line := range asm {
+		if label, ok := funcLabel(line.Text); ok {
+			funcs = append(funcs, funcStat{Name: label})
+			continue
+		}
+		if !isInstruction(line.Text) {
+			continue
+		}
+		total++
+		if len(funcs) > 0 {
+			funcs[len(funcs)-1].Instructions++
+		}
+	}
+	return total, funcs
+}
+
+// printStats prints the instruction totals under a stats header
+func printStats(w io.Writer, asm []AsmLine) {
+	total, funcs := asmStats(asm)
+	fmt.Fprintln(w, "\n"+colorize("36", "━━━ Stats ━━━"))
+
+	width := 0
+	for _, f := range funcs {
+		width = max(width, len(f.Name))
+	}
+	for _, f := range funcs {
+		fmt.Fprintf(w, "  %-*s  %d\n", width, f.Name, f.Instructions)
+	}
+	fmt.Fprintln(w, colorize("1", fmt.Sprintf("  %d instructions in %d functions", total, len(funcs))))
+}
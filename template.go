@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateData is what a -template is executed against: the compile response
+// (.Code, .Asm, .Stdout, .Stderr, .ExecResult, ...) plus fields derived from it
+type templateData struct {
+	*CompileResponse
+	File         string
+	Compiler     string
+	Instructions int
+	Functions    []funcStat
+	Cached       bool
+	RoundTrip    time.Duration
+}
+
+// templateFuncs are the functions available to -template besides the builtins
+var templateFuncs = template.FuncMap{
+	// text joins compiler or program output lines: {{text .Stderr}}
+	"text": func(lines []OutputLine) string {
+		texts := make([]string, len(lines))
+		for i, line := range lines {
+			texts[i] = line.Text
+		}
+		return strings.Join(texts, "\n")
+	},
+	// asm is the plain assembly text: {{asm .Asm}}
+	"asm": func(asm []AsmLine) string {
+		return strings.TrimSuffix(plainAsm(asm), "\n")
+	},
+	"join": strings.Join,
+	"json": func(v any) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+}
+
+// parseTemplate parses a -template string
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("cet").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// printTemplate executes the -template for a compile result, ending its
+// output with a newline if the template didn't
+func printTemplate(w io.Writer, opts Options, filePath string, res *compileResult) error {
+	insns, funcs := asmStats(res.Asm)
+	data := templateData{
+		CompileResponse: res.CompileResponse,
+		File:            sourceName(opts, filePath),
+		Compiler:        opts.Compiler,
+		Instructions:    insns,
+		Functions:       funcs,
+		Cached:          res.cached,
+		RoundTrip:       res.roundTrip.Round(time.Millisecond),
+	}
+	var b strings.Builder
+	if err := opts.Template.Execute(&b, data); err != nil {
+		return fmt.Errorf("-template: %w", err)
+	}
+	out := b.String()
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	_, err := io.WriteString(w, out)
+	return err
+}
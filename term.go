@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// isTerminal reports whether f is attached to a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// supportsANSI guesses whether the terminal understands escape sequences.
+// Everything but legacy Windows consoles does; modern Windows terminals advertise themselves.
+func supportsANSI() bool {
+	if runtime.GOOS != "windows" {
+		return true
+	}
+	return os.Getenv("WT_SESSION") != "" || os.Getenv("ANSICON") != "" ||
+		os.Getenv("ConEmuANSI") == "ON" || os.Getenv("TERM") != ""
+}
+
+// clearScreen clears the terminal and its scrollback through w, the writer
+// for stdout. Output redirected to a file or pipe is left untouched.
+func clearScreen(w io.Writer) {
+	if !isTerminal(os.Stdout) {
+		return
+	}
+	if supportsANSI() {
+		fmt.Fprint(w, "\033[H\033[2J\033[3J")
+		return
+	}
+	cmd := exec.Command("cmd", "/c", "cls")
+	cmd.Stdout = w
+	cmd.Run()
+}
+
+// useColor resolves -color: "auto" colors only a terminal without NO_COLOR or
+// -no-color, "always" forces color even into files and pipes, "never" disables it
+func useColor(mode string, noColor bool) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout), nil
+	}
+	return false, fmt.Errorf("invalid -color %q (use auto, always or never)", mode)
+}
+
+// terminalFormatter resolves -color-depth to a chroma formatter name. "auto"
+// picks 24-bit color when the terminal advertises it through COLORTERM.
+func terminalFormatter(depth string) (string, error) {
+	switch depth {
+	case "auto":
+		if ct := os.Getenv("COLORTERM"); ct == "truecolor" || ct == "24bit" {
+			return "terminal16m", nil
+		}
+		return "terminal256", nil
+	case "16m":
+		return "terminal16m", nil
+	case "256":
+		return "terminal256", nil
+	case "8":
+		return "terminal8", nil
+	}
+	return "", fmt.Errorf("invalid -color-depth %q (use auto, 256, 16m or 8)", depth)
+}
+
+// terminalWidth returns the width of the terminal on stdout, from $COLUMNS or
+// the terminal driver, defaulting to 80 columns
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	if isTerminal(os.Stdout) {
+		if n := ttyColumns(os.Stdout); n > 0 {
+			return n
+		}
+	}
+	return 80
+}
+
+// separator is a full-width rule labeled with a timestamp, printed between
+// watch iterations with -no-clear
+func separator(t time.Time) string {
+	label := "── " + t.Format("15:04:05") + " "
+	width := max(terminalWidth()-utf8.RuneCountInString(label), 3)
+	return label + strings.Repeat("─", width)
+}
+
+// spinnerDelay is how long a request runs before the spinner appears, so
+// cached and quick responses don't flicker
+const spinnerDelay = 200 * time.Millisecond
+
+// spinner animates a note on stderr while a request is in flight. Writes
+// through it (warnings, -verbose logs) stop the animation first, so the note
+// never shares a line with them.
+type spinner struct {
+	stderr   io.Writer
+	once     sync.Once
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// startSpinner animates text on stderr until Stop, which erases it. Nothing is
+// drawn unless the process's stdout and stderr are both terminals; the output
+// writer itself is often a buffer (watch prints each compile once it is done).
+func startSpinner(stderr io.Writer, text string) *spinner {
+	s := &spinner{stderr: stderr, done: make(chan struct{}), finished: make(chan struct{})}
+	if !isTerminal(os.Stdout) || !isTerminal(os.Stderr) || !supportsANSI() {
+		close(s.finished)
+		return s
+	}
+
+	go func() {
+		defer close(s.finished)
+		select {
+		case <-s.done:
+			return
+		case <-time.After(spinnerDelay):
+		}
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		frames := []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+		for i := 0; ; i++ {
+			fmt.Fprint(stderr, "\r"+colorize("2", string(frames[i%len(frames)])+" "+text))
+			select {
+			case <-s.done:
+				fmt.Fprint(stderr, "\r\033[K")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// Stop ends the animation and erases it; later calls do nothing
+func (s *spinner) Stop() {
+	s.once.Do(func() {
+		close(s.done)
+		<-s.finished
+	})
+}
+
+func (s *spinner) Write(p []byte) (int, error) {
+	s.Stop()
+	return s.stderr.Write(p)
+}
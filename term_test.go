@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestUseColor(t *testing.T) {
+	tests := []struct {
+		mode    string
+		noColor bool
+		env     string // NO_COLOR
+		want    bool
+		wantErr bool
+	}{
+		{mode: "always", want: true},
+		{mode: "always", noColor: true, want: true},
+		{mode: "always", env: "1", want: true},
+		{mode: "never", want: false},
+		// go test's stdout is not a terminal, so auto never colors here
+		{mode: "auto", want: false},
+		{mode: "auto", noColor: true, want: false},
+		{mode: "auto", env: "1", want: false},
+		{mode: "sometimes", wantErr: true},
+		{mode: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.env)
+		got, err := useColor(tt.mode, tt.noColor)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("useColor(%q, %v) with NO_COLOR=%q: error %v, want error %v", tt.mode, tt.noColor, tt.env, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("useColor(%q, %v) with NO_COLOR=%q = %v, want %v", tt.mode, tt.noColor, tt.env, got, tt.want)
+		}
+	}
+}
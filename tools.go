@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// mcaToolID is Compiler Explorer's ID for the trunk build of llvm-mca
+const mcaToolID = "llvm-mcatrunk"
+
+// printTool prints a tool's report under its own header, noting a nonzero exit
+// code; the tool's own stderr goes to stderr
+func printTool(w, stderr io.Writer, tool ToolResult) {
+	name := tool.Name
+	if name == "" {
+		name = tool.ID
+	}
+	fmt.Fprintln(w, "\n"+colorize("36", fmt.Sprintf("━━━ %s ━━━", name)))
+	for _, line := range tool.Stdout {
+		fmt.Fprintln(w, line.Text)
+	}
+	for _, line := range tool.Stderr {
+		fmt.Fprintln(stderr, colorize("31", line.Text))
+	}
+	if tool.Code != 0 {
+		fmt.Fprintln(w, colorize("31", fmt.Sprintf("✗ %s failed (exit code %d)", name, tool.Code)))
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// The panes of -tui, indexing tuiState's per-pane cursor and scroll position
+const (
+	sourcePane = iota
+	asmPane
+)
+
+// tuiState is what -tui shows: the last compile of the file, which pane has
+// focus, and each pane's cursor and scroll position
+type tuiState struct {
+	opts     Options
+	filePath string
+
+	source   []string // plain source lines, tabs expanded
+	sourceHl []string // the same lines highlighted
+	asm      []AsmLine
+	asmHl    []string
+	notes    []string // compiler output shown in place of missing assembly
+
+	status    string
+	compiling bool
+
+	focus  int
+	cursor [2]int
+	top    [2]int
+	cols   int
+	rows   int
+}
+
+// tuiUpdate is the outcome of a background compile
+type tuiUpdate struct {
+	source []byte
+	result *compileResult
+	err    error
+}
+
+// runTUI shows the source and assembly of one file in two panes that scroll
+// independently, recompiling when the project changes. Moving through one
+// pane marks the lines it maps to in the other. Returns when the user quits
+// or ctx is cancelled.
+func runTUI(ctx context.Context, opts Options, filePath string) error {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return fmt.Errorf("-tui needs a terminal")
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	searchDir, err := projectSearchDir(opts, absPath)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+	skipDirs := skipDirSet(opts.SkipDirs)
+	if !opts.NoMultifile {
+		if err := addWatchTree(watcher, searchDir, skipDirs); err != nil {
+			return fmt.Errorf("failed to watch directory: %w", err)
+		}
+	}
+	if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+		return fmt.Errorf("failed to watch directory: %w", err)
+	}
+	include := projectFileFilter(opts, absPath, searchDir)
+
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return err
+	}
+	// Alternate screen, hidden cursor; undone on the way out
+	fmt.Print("\033[?1049h\033[?25l")
+	defer func() {
+		fmt.Print("\033[?25h\033[?1049l")
+		restore()
+	}()
+
+	// Warnings and retry notes would scribble over the screen
+	opts.Stderr = io.Discard
+	opts.API = reportingTo(opts.API, io.Discard, false)
+
+	keys := make(chan string)
+	go readKeys(keys)
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+
+	s := &tuiState{opts: opts, filePath: filePath}
+	s.resize()
+
+	updates := make(chan tuiUpdate, 1)
+	start := func() {
+		s.compiling = true
+		go func() {
+			p := prepare(opts, filePath)
+			if p.err != nil {
+				updates <- tuiUpdate{err: p.err}
+				return
+			}
+			started := time.Now()
+			result, cached, err := fetch(ctx, opts, filePath, p.req)
+			var res *compileResult
+			if err == nil {
+				res = &compileResult{CompileResponse: result, cached: cached, roundTrip: time.Since(started)}
+			}
+			updates <- tuiUpdate{source: p.source, result: res, err: err}
+		}()
+	}
+	start()
+	s.draw()
+
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	pending := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case key := <-keys:
+			if key == "q" || key == "ctrl-c" {
+				return nil
+			}
+			s.handleKey(key)
+		case <-resized:
+			s.resize()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if !skipDirs[info.Name()] {
+						addWatchTree(watcher, event.Name, skipDirs)
+					}
+					continue
+				}
+			}
+			// The main file recompiles whatever -include and -exclude say
+			if (event.Name == absPath && writesFile(event)) || (!opts.NoMultifile && shouldRecompile(event, include, searchDir, skipDirs)) {
+				debounce.Reset(max(opts.Debounce, time.Millisecond))
+			}
+			continue
+		case <-debounce.C:
+			// One compile at a time; a change during it compiles again afterwards
+			if s.compiling {
+				pending = true
+				continue
+			}
+			start()
+		case u := <-updates:
+			s.compiling = false
+			s.update(u)
+			if pending {
+				pending = false
+				start()
+			}
+		case <-watcher.Errors:
+			continue
+		}
+		s.draw()
+	}
+}
+
+// readKeys turns terminal input into key names, sending them on keys
+func readKeys(keys chan<- string) {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+	}
+}
+
+// escapeKeys maps the escape sequences terminals send for navigation keys
+var escapeKeys = map[string]string{
+	"\033[A": "up", "\033[B": "down", "\033[C": "right", "\033[D": "left",
+	"\033[5~": "pgup", "\033[6~": "pgdn",
+	"\033[H": "home", "\033[F": "end", "\033[1~": "home", "\033[4~": "end",
+	"\033OA": "up", "\033OB": "down", "\033OC": "right", "\033OD": "left",
+}
+
+// parseKeys splits one read of input into key names
+func parseKeys(input []byte) []string {
+	var keys []string
+	for text := string(input); text != ""; {
+		if text[0] == '\033' {
+			matched := false
+			for seq, key := range escapeKeys {
+				if strings.HasPrefix(text, seq) {
+					keys, text, matched = append(keys, key), text[len(seq):], true
+					break
+				}
+			}
+			if !matched {
+				// An unknown sequence or a lone Escape: drop the rest of the read
+				return keys
+			}
+			continue
+		}
+		switch c := text[0]; c {
+		case '\t':
+			keys = append(keys, "tab")
+		case 3:
+			keys = append(keys, "ctrl-c")
+		case 'j':
+			keys = append(keys, "down")
+		case 'k':
+			keys = append(keys, "up")
+		case 'h':
+			keys = append(keys, "left")
+		case 'l':
+			keys = append(keys, "right")
+		case ' ':
+			keys = append(keys, "pgdn")
+		default:
+			keys = append(keys, string(c))
+		}
+		text = text[1:]
+	}
+	return keys
+}
+
+// update takes in a finished compile
+func (s *tuiState) update(u tuiUpdate) {
+	if u.err != nil {
+		s.status = colorize("31", "✗ "+u.err.Error())
+		return
+	}
+	s.source = splitLines(expandTabs(string(u.source)))
+	s.sourceHl = highlightLines(expandTabs(strings.TrimSuffix(string(u.source), "\n")), getLangFromFile(sourceName(s.opts, s.filePath), s.opts.Lang), s.opts)
+	s.asm = u.result.Asm
+	s.asmHl = highlightLines(expandTabs(strings.TrimSuffix(plainAsm(s.asm), "\n")), "gas", s.opts)
+	s.notes = nil
+	for _, line := range u.result.Stderr {
+		s.notes = append(s.notes, expandTabs(line.Text))
+	}
+	s.status = u.result.status() + " " + colorize("2", time.Now().Format("15:04:05"))
+	for pane := range 2 {
+		s.cursor[pane] = min(s.cursor[pane], max(s.lines(pane)-1, 0))
+	}
+	s.scrollTo(s.focus, s.cursor[s.focus])
+}
+
+// resize reads the terminal size
+func (s *tuiState) resize() {
+	s.cols, s.rows = ttySize(os.Stdout)
+	if s.cols <= 0 || s.rows <= 0 {
+		s.cols, s.rows = terminalWidth(), 24
+	}
+	s.scrollTo(s.focus, s.cursor[s.focus])
+}
+
+// height is the number of lines each pane shows, between the title and key bars
+func (s *tuiState) height() int {
+	return max(s.rows-2, 1)
+}
+
+// lines is the number of lines in a pane
+func (s *tuiState) lines(pane int) int {
+	if pane == sourcePane {
+		return len(s.source)
+	}
+	return len(s.asm)
+}
+
+// selected is the main-file line under the cursor of the focused pane (0 = none)
+func (s *tuiState) selected() int {
+	if s.focus == sourcePane {
+		if s.cursor[sourcePane] < len(s.source) {
+			return s.cursor[sourcePane] + 1
+		}
+		return 0
+	}
+	if i := s.cursor[asmPane]; i < len(s.asm) {
+		if src := s.asm[i].Source; src != nil && src.File == nil {
+			return src.Line
+		}
+	}
+	return 0
+}
+
+func (s *tuiState) handleKey(key string) {
+	pane := s.focus
+	n := s.lines(pane)
+	cursor := s.cursor[pane]
+	switch key {
+	case "tab", "left", "right":
+		s.focus = 1 - s.focus
+		s.follow()
+		return
+	case "up":
+		cursor--
+	case "down":
+		cursor++
+	case "pgup":
+		cursor -= s.height()
+	case "pgdn":
+		cursor += s.height()
+	case "home", "g":
+		cursor = 0
+	case "end", "G":
+		cursor = n - 1
+	default:
+		return
+	}
+	s.cursor[pane] = max(min(cursor, n-1), 0)
+	s.scrollTo(pane, s.cursor[pane])
+	s.follow()
+}
+
+// follow scrolls the unfocused pane to the first line mapped to the selection,
+// unless one is already in view
+func (s *tuiState) follow() {
+	sel := s.selected()
+	if sel == 0 {
+		return
+	}
+	if s.focus == asmPane {
+		s.scrollTo(sourcePane, sel-1)
+		return
+	}
+	first := -1
+	for i, line := range s.asm {
+		if fromLine(line, sel) {
+			if i >= s.top[asmPane] && i < s.top[asmPane]+s.height() {
+				return
+			}
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	if first >= 0 {
+		s.scrollTo(asmPane, first)
+	}
+}
+
+// scrollTo scrolls a pane just enough to show line i
+func (s *tuiState) scrollTo(pane, i int) {
+	h := s.height()
+	if i < s.top[pane] {
+		s.top[pane] = i
+	} else if i >= s.top[pane]+h {
+		s.top[pane] = i - h + 1
+	}
+	s.top[pane] = max(min(s.top[pane], s.lines(pane)-h), 0)
+}
+
+// draw repaints the whole screen in one write
+func (s *tuiState) draw() {
+	leftWidth := (s.cols - 3) / 2
+	rightWidth := s.cols - 3 - leftWidth
+	sel := s.selected()
+
+	var b strings.Builder
+	b.WriteString("\033[H")
+	status := s.status
+	if s.compiling {
+		status = colorize("2", "compiling…")
+	}
+	title := colorize("1;36", fmt.Sprintf(" %s · %s ", s.filePath, s.opts.Compiler)) + status
+	b.WriteString(fitWidth(title, s.cols, false) + "\033[K\r\n")
+
+	for row := range s.height() {
+		// Source: line number, mark, text
+		left := strings.Repeat(" ", leftWidth)
+		if i := s.top[sourcePane] + row; i < len(s.source) {
+			left = colorize("2", fmt.Sprintf("%4d", i+1)) + s.paneLine(sourcePane, i, sel == i+1, s.source[i], s.sourceHl, leftWidth-4)
+		}
+
+		right := ""
+		if i := s.top[asmPane] + row; i < len(s.asm) {
+			right = s.paneLine(asmPane, i, fromLine(s.asm[i], sel), expandTabs(s.asm[i].Text), s.asmHl, rightWidth)
+		} else if len(s.asm) == 0 && row < len(s.notes) {
+			right = fitWidth(colorize("31", s.notes[row]), rightWidth, false)
+		}
+		b.WriteString(left + colorize("2", " │ ") + right + "\033[K\r\n")
+	}
+
+	keys := " tab switch pane · ↑↓/jk move · PgUp/PgDn page · g/G top/bottom · q quit"
+	b.WriteString(fitWidth(colorize("2", keys), s.cols, false) + "\033[K")
+	fmt.Print(b.String())
+}
+
+// paneLine renders line i of a pane: the cursor line of the focused pane in
+// reverse video (even without -color, so it stays visible), lines mapped to
+// the selection marked and bold, the rest highlighted
+func (s *tuiState) paneLine(pane, i int, marked bool, text string, highlighted []string, width int) string {
+	mark := "  "
+	if marked {
+		mark = colorize("33", "▌ ")
+	}
+	width -= 2
+	switch {
+	case pane == s.focus && i == s.cursor[pane]:
+		return mark + "\033[7m" + fitWidth(text, width, true) + "\033[0m"
+	case marked:
+		return mark + colorize("1", fitWidth(text, width, true))
+	case i < len(highlighted):
+		return mark + fitWidth(highlighted[i], width, true)
+	}
+	return mark + fitWidth(text, width, true)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A view is an output section selectable with -view. The assembly view is the
+// default and is rendered by compile itself (diff, interleave and stats apply to it).
+type view struct {
+	header string
+	lexer  string // chroma lexer; empty means the source file's language
+
+	// request enables the view's output in the compiler options
+	request func(co *CompilerOptions)
+
+	// text extracts the view's output, reporting false when the compiler returned none
+	text func(r *CompileResponse) (string, bool)
+}
+
+const defaultView = "asm"
+
+var views = map[string]view{
+	defaultView: {},
+	"ast": {
+		header:  "AST",
+		lexer:   "plaintext",
+		request: func(co *CompilerOptions) { co.ProduceAst = true },
+		text: func(r *CompileResponse) (string, bool) {
+			if len(r.AstOutput) == 0 {
+				return "", false
+			}
+			var b strings.Builder
+			for _, line := range r.AstOutput {
+				b.WriteString(line.Text)
+				b.WriteString("\n")
+			}
+			return b.String(), true
+		},
+	},
+	"preprocessed": {
+		header:  "Preprocessed",
+		request: func(co *CompilerOptions) { co.ProducePp = &PpOptions{FilterHeaders: true} },
+		text: func(r *CompileResponse) (string, bool) {
+			if r.PpOutput == nil || r.PpOutput.Output == "" {
+				return "", false
+			}
+			return r.PpOutput.Output, true
+		},
+	},
+}
+
+// viewNames lists the valid -view values, for error messages
+func viewNames() string {
+	names := make([]string, 0, len(views))
+	for name := range views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// printView prints a non-assembly view, warning when the compiler didn't produce it
+func printView(w io.Writer, name string, v view, result *CompileResponse, lang string, opts Options) {
+	text, ok := v.text(result)
+	if !ok {
+		if result.Code == 0 {
+			fmt.Fprintln(opts.Stderr, colorize("33", fmt.Sprintf("Warning: compiler %s returned no %s output for -view=%s", opts.Compiler, v.header, name)))
+		}
+		return
+	}
+	lexer := v.lexer
+	if lexer == "" {
+		lexer = lang
+	}
+	fmt.Fprintln(w, "\n"+colorize("36", fmt.Sprintf("━━━ %s ━━━", v.header)))
+	fmt.Fprint(w, highlight(text, lexer, opts.Style, opts.Formatter))
+}
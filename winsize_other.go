@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package main
+
+import "os"
+
+// ttyColumns is not implemented on this platform; terminalWidth falls back to $COLUMNS
+func ttyColumns(f *os.File) int {
+	return 0
+}
+
+// ttySize is not implemented on this platform
+func ttySize(f *os.File) (cols, rows int) {
+	return 0, 0
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ttyColumns asks the terminal driver for the width of f, or returns 0
+func ttyColumns(f *os.File) int {
+	cols, _ := ttySize(f)
+	return cols
+}
+
+// ttySize asks the terminal driver for the width and height of f, or returns zeros
+func ttySize(f *os.File) (cols, rows int) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0
+	}
+	return int(ws.Col), int(ws.Row)
+}